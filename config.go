@@ -1,13 +1,27 @@
 package main
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/daminit/traffics-cli/infra/constant"
 	"github.com/daminit/traffics-cli/infra/meta"
+	"github.com/daminit/traffics-cli/infra/networks/dialer"
+	"github.com/daminit/traffics-cli/infra/networks/listener"
+	"github.com/daminit/traffics-cli/infra/networks/proxyproto"
+	"github.com/daminit/traffics-cli/infra/networks/resolve"
+	"github.com/daminit/traffics-cli/infra/networks/tlsconf"
+	"github.com/daminit/traffics-cli/proxy/outbounds"
+	"github.com/daminit/traffics-cli/proxy/route"
+	"github.com/daminit/traffics-cli/proxy/sessions"
+	"github.com/daminit/traffics-cli/proxy/socks"
+	"net"
+	"net/http"
 	"net/netip"
 	"net/url"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -17,6 +31,13 @@ type Config struct {
 	Binds  []BindConfig   `json:"binds,omitempty"`
 	Remote []RemoteConfig `json:"remotes,omitempty"`
 	Log    LogConfig      `json:"log,omitempty"`
+
+	Metrics   MetricsConfig   `json:"metrics,omitempty"`
+	AccessLog AccessLogConfig `json:"access_log,omitempty"`
+
+	// static addresses checked before any dns server
+	Hosts     map[string]meta.StringList `json:"hosts,omitempty"`      // name to addresses
+	HostsFile string                     `json:"hosts_file,omitempty"` // in /etc/hosts format
 }
 
 func NewConfig() Config {
@@ -27,12 +48,40 @@ func NewConfig() Config {
 	}
 }
 
+// hosts returns the static hosts table of c.
+func (c *Config) hosts() (*resolve.Hosts, error) {
+	options := resolve.HostsOptions{
+		Hosts: make(map[string][]netip.Addr, len(c.Hosts)),
+		File:  c.HostsFile,
+	}
+	for name, addresses := range c.Hosts {
+		for _, address := range addresses {
+			addr, err := netip.ParseAddr(address)
+			if err != nil {
+				return nil, fmt.Errorf("hosts(%s): %w", name, err)
+			}
+			options.Hosts[name] = append(options.Hosts[name], addr)
+		}
+	}
+	return resolve.NewHosts(options)
+}
+
 type LogConfig struct {
 	Disable bool   `json:"disable,omitempty"`
 	Level   string `json:"level,omitempty"`
 	Format  string `json:"format,omitempty"`
 }
 
+type AccessLogConfig struct {
+	Path   string `json:"path,omitempty"`   // file path, stdout or stderr
+	Format string `json:"format,omitempty"` // json or a line template
+}
+
+type MetricsConfig struct {
+	Listen string `json:"listen,omitempty"`
+	Path   string `json:"path,omitempty"` // default: /metrics
+}
+
 type BindConfig struct {
 	Raw string `json:"-,omitempty"`
 
@@ -43,6 +92,7 @@ type BindConfig struct {
 	// meta(optional)
 	Name    string            `json:"name,omitempty"`
 	Network meta.ProtocolList `json:"network,omitempty"`
+	PortEnd uint16            `json:"port_end,omitempty"` // listen on every port from Port to PortEnd
 
 	// below is configured by args
 	Family    string `json:"family,omitempty"`
@@ -53,18 +103,73 @@ type BindConfig struct {
 	TFO   bool `json:"tfo,omitempty"`
 	MPTCP bool `json:"mptcp,omitempty"`
 
+	// unix, Listen is the socket path
+	UnixMode  string `json:"unix_mode,omitempty"`  // octal, e.g. 0660
+	UnixOwner string `json:"unix_owner,omitempty"` // user[:group]
+
 	// udp configuration
 	UDPKeepaliveTTL time.Duration `json:"udp_ttl,omitempty"`
 	UDPBufferSize   int           `json:"udp_buffer_size,omitempty"` // byte
 	UDPFragment     bool          `json:"udp_fragment,omitempty"`
+	UDPMaxSessions  int           `json:"udp_max_sessions,omitempty"`
+	UDPOverflow     string        `json:"udp_overflow,omitempty"` // evict or drop
+
+	// PROXY protocol
+	ProxyProtocol        bool            `json:"proxy_protocol,omitempty"`
+	ProxyProtocolTrusted meta.PrefixList `json:"proxy_protocol_trusted,omitempty"`
+	ProxyProtocolTimeout time.Duration   `json:"proxy_protocol_timeout,omitempty"`
+
+	// TLS termination, the n-th tls_key belongs to the n-th tls_cert
+	TLSCert       meta.StringList `json:"tls_cert,omitempty"`
+	TLSKey        meta.StringList `json:"tls_key,omitempty"`
+	TLSMinVersion string          `json:"tls_min_version,omitempty"` // default: 1.2
+	TLSALPN       meta.StringList `json:"tls_alpn,omitempty"`
+
+	// routing of tcp and unix connections, Remote is the default
+	ProtocolRoutes  map[route.Protocol]string `json:"protocol_routes,omitempty"`   // ssh, tls, http or timeout => remote
+	SNIRoutes       map[string]string         `json:"sni_routes,omitempty"`        // host pattern => remote
+	HTTPRoutes      map[string]string         `json:"http_routes,omitempty"`       // host pattern[/path prefix] => remote
+	RouteTimeout    time.Duration             `json:"route_timeout,omitempty"`     // also bounds reading the http request head
+	RouteHeaderSize int                       `json:"route_header_size,omitempty"` // byte
+
+	// SOCKS5 server, Remote only lends its dialer to reach the destinations
+	Mode       string          `json:"mode,omitempty"`        // empty forwards to the remotes, socks5 serves SOCKS5
+	SocksUsers meta.StringList `json:"socks_users,omitempty"` // user:password, empty means no authentication
+	SocksAllow meta.StringList `json:"socks_allow,omitempty"` // CIDRs, addresses or host patterns
+	SocksPorts meta.StringList `json:"socks_ports,omitempty"` // ports or port ranges like 8000-9000
+
+	// access control
+	Allow             meta.PrefixList `json:"allow,omitempty"`
+	Deny              meta.PrefixList `json:"deny,omitempty"`
+	AllowFile         string          `json:"allow_file,omitempty"`
+	DenyFile          string          `json:"deny_file,omitempty"`
+	RejectLogInterval time.Duration   `json:"reject_log_interval,omitempty"`
+
+	// limits, zero means unlimited
+	MaxConns       int     `json:"max_conns,omitempty"`
+	MaxConnsPerIP  int     `json:"max_conns_per_ip,omitempty"`
+	ConnRate       float64 `json:"conn_rate,omitempty"`        // per source, per second
+	UDPSessionRate float64 `json:"udp_session_rate,omitempty"` // per source, per second
+
+	// set on the binds expanded from a port range
+	rangeIndex uint16
+	rangeSize  uint16
 }
 
 type _BindConfig BindConfig
 
+const bindModeSocks5 = "socks5"
+
 func NewDefaultBind() BindConfig {
 	return BindConfig{
 		UDPKeepaliveTTL: constant.DefaultUDPKeepAlive,
 		UDPBufferSize:   constant.DefaultUDPReadBufferSize,
+		UDPMaxSessions:  constant.DefaultUDPMaxSessions,
+
+		ProxyProtocolTimeout: constant.DefaultProxyProtocolTimeout,
+		RejectLogInterval:    constant.DefaultRejectLogInterval,
+		RouteTimeout:         constant.DefaultRouteTimeout,
+		RouteHeaderSize:      constant.DefaultRouteHeaderSize,
 	}
 }
 
@@ -75,6 +180,93 @@ func (c *BindConfig) valid() error {
 	if c.UDPKeepaliveTTL == 0 {
 		return fmt.Errorf("udp keepalive ttl can not be zero")
 	}
+	if c.PortEnd != 0 && c.PortEnd <= c.Port {
+		return fmt.Errorf("port range end must be greater than the start")
+	}
+	if slices.ContainsFunc(c.Network, meta.Protocol.IsUnix) {
+		if len(c.Network) != 1 {
+			return fmt.Errorf("unix sockets can not be mixed with other networks")
+		}
+		if c.Listen == "" {
+			return fmt.Errorf("no socket path specified")
+		}
+		if c.PortEnd != 0 || c.hasACL() || c.MaxConnsPerIP != 0 || c.ConnRate != 0 {
+			return fmt.Errorf("port ranges, access control and per source limits are not supported on unix sockets")
+		}
+	}
+	if c.UnixMode != "" {
+		if _, err := listener.ParseMode(c.UnixMode); err != nil {
+			return err
+		}
+	}
+	if len(c.TLSCert) != len(c.TLSKey) {
+		return fmt.Errorf("every tls certificate requires a key")
+	}
+	if c.hasTLS() && !slices.ContainsFunc(c.Network, meta.Protocol.IsStream) {
+		return fmt.Errorf("tls requires a tcp or unix bind")
+	}
+	if _, err := tlsconf.ParseVersion(c.TLSMinVersion); err != nil {
+		return err
+	}
+	for pattern := range c.SNIRoutes {
+		if err := route.ValidPattern(pattern); err != nil {
+			return err
+		}
+	}
+	for protocol := range c.ProtocolRoutes {
+		if err := route.ValidProtocol(string(protocol)); err != nil {
+			return err
+		}
+	}
+	for pattern := range c.HTTPRoutes {
+		if err := route.ValidHTTPPattern(pattern); err != nil {
+			return err
+		}
+	}
+	if c.hasRoutes() {
+		if !slices.ContainsFunc(c.Network, meta.Protocol.IsStream) {
+			return fmt.Errorf("routes require a tcp or unix bind")
+		}
+		if (len(c.SNIRoutes) != 0 || c.ProtocolRoutes[route.ProtocolTLS] != "") && c.hasTLS() {
+			return fmt.Errorf("sni and tls protocol routes can not be used with tls termination")
+		}
+		if c.RouteTimeout <= 0 {
+			return fmt.Errorf("route timeout must greater than 0")
+		}
+		if len(c.HTTPRoutes) != 0 && c.RouteHeaderSize <= 0 {
+			return fmt.Errorf("route header size must greater than 0")
+		}
+	}
+	switch c.Mode {
+	case "":
+		if len(c.SocksUsers) != 0 || len(c.SocksAllow) != 0 || len(c.SocksPorts) != 0 {
+			return fmt.Errorf("socks options require a socks5 bind")
+		}
+	case bindModeSocks5:
+		if !slices.Equal(c.Network, meta.ProtocolList{meta.ProtocolTCP}) {
+			return fmt.Errorf("socks5 binds only listen on tcp")
+		}
+		if c.hasRoutes() {
+			return fmt.Errorf("routes can not be used with socks5 binds")
+		}
+		if _, err := c.socksServer(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown bind mode: %s", c.Mode)
+	}
+	if c.UDPMaxSessions < 0 {
+		return fmt.Errorf("udp max sessions can not be negative")
+	}
+	if _, err := sessions.ParseOverflowPolicy(c.UDPOverflow); err != nil {
+		return err
+	}
+	if c.ProxyProtocol && c.ProxyProtocolTimeout <= 0 {
+		return fmt.Errorf("proxy protocol timeout must greater than 0")
+	}
+	if c.MaxConns < 0 || c.MaxConnsPerIP < 0 || c.ConnRate < 0 || c.UDPSessionRate < 0 {
+		return fmt.Errorf("limits can not be negative")
+	}
 	return nil
 }
 
@@ -82,19 +274,225 @@ func (c *BindConfig) IsValid() bool {
 	return c.valid() == nil
 }
 
+// displayName returns the name of this bind used in logs, it is unique
+// among the binds of a config.
+func (c *BindConfig) displayName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if slices.ContainsFunc(c.Network, meta.Protocol.IsUnix) {
+		return "(" + c.Listen + ")"
+	}
+	port := strconv.FormatUint(uint64(c.Port), 10)
+	if c.PortEnd != 0 {
+		port += "-" + strconv.FormatUint(uint64(c.PortEnd), 10)
+	}
+	return "(" + net.JoinHostPort(c.Listen, port) + ")"
+}
+
+// parseRoutes parses comma separated "pattern=remote" items.
+func parseRoutes(items []string) (map[string]string, error) {
+	routes := make(map[string]string)
+	for _, item := range items {
+		for _, r := range meta.ParseStringList(item) {
+			pattern, remote, ok := strings.Cut(r, "=")
+			if !ok || pattern == "" || remote == "" {
+				return nil, fmt.Errorf("expected pattern=remote, got %s", r)
+			}
+			routes[pattern] = remote
+		}
+	}
+	return routes, nil
+}
+
+// unixSocketPath returns the socket path of rawURL if its scheme, or the
+// last '+' separated part of it, is unix or unixgram.
+func unixSocketPath(rawURL string) (string, meta.Protocol, bool) {
+	scheme, rest, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return "", "", false
+	}
+	if i := strings.LastIndexByte(scheme, '+'); i >= 0 {
+		scheme = scheme[i+1:]
+	}
+	protocol := meta.Protocol(scheme)
+	if !protocol.IsUnix() {
+		return "", "", false
+	}
+	path, _, _ := strings.Cut(rest, "?")
+	return path, protocol, true
+}
+
+// cutPortRange cuts the end of a port range like "27000-27100" from the
+// host of rawURL, which url.Parse does not accept.
+func cutPortRange(rawURL string) (string, uint16, error) {
+	_, rest, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return rawURL, 0, nil
+	}
+	start := len(rawURL) - len(rest)
+	end := start + len(rest)
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		end = start + i
+	}
+	host := rawURL[start:end]
+	colon := strings.LastIndexByte(host, ':')
+	if colon < 0 || strings.Contains(host[colon:], "]") {
+		return rawURL, 0, nil
+	}
+	first, last, ok := strings.Cut(host[colon+1:], "-")
+	if !ok {
+		return rawURL, 0, nil
+	}
+	pp, err := strconv.ParseUint(last, 10, 16)
+	if err != nil {
+		return "", 0, err
+	}
+	return rawURL[:start+colon+1] + first + rawURL[end:], uint16(pp), nil
+}
+
+func (c *BindConfig) hasRoutes() bool {
+	return len(c.ProtocolRoutes) != 0 || len(c.SNIRoutes) != 0 || len(c.HTTPRoutes) != 0
+}
+
+// remotes returns the names of every remote this bind forwards to.
+func (c *BindConfig) remotes() []string {
+	var names []string
+	if c.Remote != "" {
+		names = append(names, c.Remote)
+	}
+	for _, remote := range c.ProtocolRoutes {
+		names = append(names, remote)
+	}
+	for _, remote := range c.SNIRoutes {
+		names = append(names, remote)
+	}
+	for _, remote := range c.HTTPRoutes {
+		names = append(names, remote)
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+func (c *BindConfig) hasACL() bool {
+	return len(c.Allow) != 0 || len(c.Deny) != 0 || c.AllowFile != "" || c.DenyFile != ""
+}
+
+// expand returns a bind for every port of a port range, named after this
+// bind and the port, or this bind itself if it has a single port.
+func (c BindConfig) expand() []BindConfig {
+	if c.PortEnd == 0 {
+		return []BindConfig{c}
+	}
+	prefix := c.displayName()
+	binds := make([]BindConfig, 0, int(c.PortEnd-c.Port)+1)
+	for port := int(c.Port); port <= int(c.PortEnd); port++ {
+		bind := c
+		bind.Name = prefix + "/" + strconv.Itoa(port)
+		bind.Port = uint16(port)
+		bind.PortEnd = 0
+		bind.rangeIndex = uint16(port) - c.Port
+		bind.rangeSize = c.PortEnd - c.Port + 1
+		binds = append(binds, bind)
+	}
+	return binds
+}
+
+// portOffset returns the offset added to the server ports of remote for
+// connections of this bind.
+func (c *BindConfig) portOffset(remote RemoteConfig) (uint16, error) {
+	switch {
+	case remote.PortEnd != 0:
+		if size := remote.PortEnd - remote.Port + 1; size != max(c.rangeSize, 1) {
+			return 0, fmt.Errorf("remote %s covers %d ports but bind covers %d", remote.Name, size, max(c.rangeSize, 1))
+		}
+		return c.rangeIndex, nil
+	case remote.Network != "":
+		return 0, nil
+	case remote.Port == 0:
+		if c.Port == 0 {
+			// unix binds have no port to lend
+			return 0, fmt.Errorf("remote %s has no port and the bind has none to map onto it", remote.Name)
+		}
+		return c.Port, nil
+	default:
+		return 0, nil
+	}
+}
+
+// portOffsets returns the port offset of the remote called name and of
+// every remote of its backup chain by name.
+func (c *BindConfig) portOffsets(remotes []RemoteConfig, name string) (map[string]uint16, error) {
+	offsets := make(map[string]uint16)
+	for name != "" {
+		if _, seen := offsets[name]; seen {
+			break
+		}
+		idx := slices.IndexFunc(remotes, func(r RemoteConfig) bool { return r.Name == name })
+		if idx < 0 {
+			return nil, fmt.Errorf("remote not found with name: %s", name)
+		}
+		offset, err := c.portOffset(remotes[idx])
+		if err != nil {
+			return nil, err
+		}
+		offsets[name] = offset
+		name = remotes[idx].Backup
+	}
+	return offsets, nil
+}
+
+// socksServer returns the SOCKS5 server of a socks5 bind.
+func (c *BindConfig) socksServer() (*socks.Server, error) {
+	allow, err := socks.ParseAllowlist(c.SocksAllow, c.SocksPorts)
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]string, len(c.SocksUsers))
+	for _, item := range c.SocksUsers {
+		user, password, ok := strings.Cut(item, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("expected user:password, got %s", item)
+		}
+		users[user] = password
+	}
+	return &socks.Server{Users: users, Allow: allow, Timeout: constant.DefaultSocksTimeout}, nil
+}
+
+func (c *BindConfig) hasTLS() bool {
+	return len(c.TLSCert) != 0
+}
+
+func (c BindConfig) equal(o BindConfig) bool {
+	c.Raw, o.Raw = "", ""
+	return reflect.DeepEqual(c, o)
+}
+
 func (c *BindConfig) Parse(s string) error {
 	if s == "" {
 		return errors.New("bind: empty string")
 	}
 
-	uu, err := url.Parse(s)
+	raw, portEnd := s, uint16(0)
+	socketPath, _, isUnix := unixSocketPath(s)
+	if !isUnix {
+		var err error
+		raw, portEnd, err = cutPortRange(s)
+		if err != nil {
+			return fmt.Errorf("bind(port): %w", err)
+		}
+	}
+	uu, err := url.Parse(raw)
 	if err != nil {
 		return fmt.Errorf("bind: %w", err)
 	}
 	nc := NewDefaultBind()
 	nc.Raw = s
 	nc.Listen = uu.Hostname()
-	if uu.Port() != "" {
+	nc.PortEnd = portEnd
+	if isUnix {
+		nc.Listen = socketPath
+	} else if uu.Port() != "" {
 		pp, err := strconv.ParseUint(uu.Port(), 10, 16)
 		if err != nil {
 			return fmt.Errorf("bind(port): %w", err)
@@ -102,7 +500,10 @@ func (c *BindConfig) Parse(s string) error {
 		nc.Port = uint16(pp)
 	}
 
-	if uu.Scheme != "" {
+	if uu.Scheme == bindModeSocks5 {
+		nc.Mode = bindModeSocks5
+		nc.Network = meta.ProtocolList{meta.ProtocolTCP}
+	} else if uu.Scheme != "" {
 		nc.Network = meta.ParseProtocolList(uu.Scheme)
 	}
 
@@ -158,6 +559,138 @@ func (c *BindConfig) Parse(s string) error {
 				return fmt.Errorf("bind(mptcp): expected bool, got %s", val)
 			}
 			nc.MPTCP = ok
+		case "udp_max_sessions":
+			size, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("bind(udp_max_sessions): %w", err)
+			}
+			nc.UDPMaxSessions = size
+		case "udp_overflow":
+			nc.UDPOverflow = val
+		case "proxy_protocol":
+			ok, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("bind(proxy_protocol): expected bool, got %s", val)
+			}
+			nc.ProxyProtocol = ok
+		case "proxy_protocol_trusted":
+			for _, item := range v {
+				prefixes, err := meta.ParsePrefixList(item)
+				if err != nil {
+					return fmt.Errorf("bind(proxy_protocol_trusted): %w", err)
+				}
+				nc.ProxyProtocolTrusted = append(nc.ProxyProtocolTrusted, prefixes...)
+			}
+		case "proxy_protocol_timeout":
+			duration, err := time.ParseDuration(val)
+			if err != nil {
+				return fmt.Errorf("bind(proxy_protocol_timeout): %w", err)
+			}
+			nc.ProxyProtocolTimeout = duration
+		case "allow", "deny":
+			var prefixes meta.PrefixList
+			for _, item := range v {
+				list, err := meta.ParsePrefixList(item)
+				if err != nil {
+					return fmt.Errorf("bind(%s): %w", k, err)
+				}
+				prefixes = append(prefixes, list...)
+			}
+			if k == "allow" {
+				nc.Allow = prefixes
+			} else {
+				nc.Deny = prefixes
+			}
+		case "allow_file":
+			nc.AllowFile = val
+		case "deny_file":
+			nc.DenyFile = val
+		case "reject_log_interval":
+			duration, err := time.ParseDuration(val)
+			if err != nil {
+				return fmt.Errorf("bind(reject_log_interval): %w", err)
+			}
+			nc.RejectLogInterval = duration
+		case "tls_cert", "tls_key", "tls_alpn":
+			var list meta.StringList
+			for _, item := range v {
+				list = append(list, meta.ParseStringList(item)...)
+			}
+			switch k {
+			case "tls_cert":
+				nc.TLSCert = list
+			case "tls_key":
+				nc.TLSKey = list
+			default:
+				nc.TLSALPN = list
+			}
+		case "tls_min_version":
+			nc.TLSMinVersion = val
+		case "socks_users", "socks_allow", "socks_ports":
+			var list meta.StringList
+			for _, item := range v {
+				list = append(list, meta.ParseStringList(item)...)
+			}
+			switch k {
+			case "socks_users":
+				nc.SocksUsers = list
+			case "socks_allow":
+				nc.SocksAllow = list
+			default:
+				nc.SocksPorts = list
+			}
+		case "protocol_routes", "sni_routes", "http_routes":
+			routes, err := parseRoutes(v)
+			if err != nil {
+				return fmt.Errorf("bind(%s): %w", k, err)
+			}
+			switch k {
+			case "protocol_routes":
+				nc.ProtocolRoutes = make(map[route.Protocol]string, len(routes))
+				for protocol, remote := range routes {
+					nc.ProtocolRoutes[route.Protocol(protocol)] = remote
+				}
+			case "sni_routes":
+				nc.SNIRoutes = routes
+			default:
+				nc.HTTPRoutes = routes
+			}
+		case "route_timeout":
+			duration, err := time.ParseDuration(val)
+			if err != nil {
+				return fmt.Errorf("bind(route_timeout): %w", err)
+			}
+			nc.RouteTimeout = duration
+		case "route_header_size":
+			size, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("bind(route_header_size): %w", err)
+			}
+			nc.RouteHeaderSize = size
+		case "unix_mode":
+			nc.UnixMode = val
+		case "unix_owner":
+			nc.UnixOwner = val
+		case "max_conns", "max_conns_per_ip":
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("bind(%s): %w", k, err)
+			}
+			if k == "max_conns" {
+				nc.MaxConns = n
+			} else {
+				nc.MaxConnsPerIP = n
+			}
+		case "conn_rate", "udp_session_rate":
+			rate, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return fmt.Errorf("bind(%s): %w", k, err)
+			}
+			if k == "conn_rate" {
+				nc.ConnRate = rate
+			} else {
+				nc.UDPSessionRate = rate
+			}
 		default:
 			return fmt.Errorf("bind: unknown option: %s", k)
 		}
@@ -190,6 +723,9 @@ func (c *BindConfig) UnmarshalJSON(bs []byte) error {
 	if err := json.Unmarshal(bs, (*_BindConfig)(&nc)); err != nil {
 		return err
 	}
+	if nc.Mode == bindModeSocks5 && len(nc.Network) == 0 {
+		nc.Network = meta.ProtocolList{meta.ProtocolTCP}
+	}
 	if err := nc.valid(); err != nil {
 		return err
 	}
@@ -203,30 +739,70 @@ type RemoteConfig struct {
 	// meta(required)
 	Name   string `json:"name,omitempty"`
 	Server string `json:"server,omitempty"`
-	Port   uint16 `json:"port,omitempty"`
+	Port   uint16 `json:"port,omitempty"` // zero means the port of the bind
 
 	// optional
-	DNS          string        `json:"dns,omitempty"`
-	Strategy     meta.Strategy `json:"strategy,omitempty"`
-	Timeout      time.Duration `json:"timeout,omitempty"`
-	ReuseAddr    bool          `json:"reuse_addr,omitempty"`
-	Interface    string        `json:"interface,omitempty"`
-	BindAddress4 netip.Addr    `json:"bind_address4,omitempty"`
-	BindAddress6 netip.Addr    `json:"bind_address6,omitempty"`
-	FwMark       uint32        `json:"fwmark,omitempty"`
+	Network      meta.Protocol   `json:"network,omitempty"`  // unix or unixgram, Server is the socket path
+	PortEnd      uint16          `json:"port_end,omitempty"` // binds of a port range map onto Port to PortEnd
+	Servers      []ServerConfig  `json:"servers,omitempty"`
+	Balance      string          `json:"balance,omitempty"`
+	DNS          meta.StringList `json:"dns,omitempty"`
+	DNSPolicy    string          `json:"dns_policy,omitempty"`  // failover, race or round_robin
+	DNSTimeout   time.Duration   `json:"dns_timeout,omitempty"` // of each query to a dns server
+	Strategy     meta.Strategy   `json:"strategy,omitempty"`
+	Timeout      time.Duration   `json:"timeout,omitempty"`
+	ReuseAddr    bool            `json:"reuse_addr,omitempty"`
+	Interface    string          `json:"interface,omitempty"`
+	BindAddress4 netip.Addr      `json:"bind_address4,omitempty"`
+	BindAddress6 netip.Addr      `json:"bind_address6,omitempty"`
+	FwMark       uint32          `json:"fwmark,omitempty"`
 
 	// tcp
 	MPTCP bool `json:"mptcp,omitempty"`
 
 	// udp
 	UDPFragment bool `json:"udp_fragment,omitempty"`
+
+	// health check
+	HealthCheck    string        `json:"health_check,omitempty"` // tcp, udp or tls
+	HealthInterval time.Duration `json:"health_interval,omitempty"`
+	HealthTimeout  time.Duration `json:"health_timeout,omitempty"`
+	HealthRise     int           `json:"health_rise,omitempty"`
+	HealthFall     int           `json:"health_fall,omitempty"`
+	HealthSend     string        `json:"health_send,omitempty"` // prefix with "hex:" for binary payload
+	HealthExpect   string        `json:"health_expect,omitempty"`
+	Backup         string        `json:"backup,omitempty"`
+
+	ProxyProtocol string `json:"proxy_protocol,omitempty"` // v1 or v2
+
+	// upstream proxy reaching the servers
+	Via        string            `json:"via,omitempty"`         // e.g. socks5://host:port
+	ViaHeaders map[string]string `json:"via_headers,omitempty"` // sent to http proxies
+
+	// TLS origination
+	TLS                bool            `json:"tls,omitempty"`
+	SNI                string          `json:"sni,omitempty"`     // default: the server address
+	CAFile             string          `json:"ca_file,omitempty"` // default: system roots
+	InsecureSkipVerify bool            `json:"insecure_skip_verify,omitempty"`
+	ClientCert         string          `json:"client_cert,omitempty"`
+	ClientKey          string          `json:"client_key,omitempty"`
+	ALPN               meta.StringList `json:"alpn,omitempty"`
 }
 
 type _RemoteConfig RemoteConfig
 
+// remoteDirect labels the built-in remote dialing the destinations of
+// socks5 binds without remote in logs and metrics. The remote itself has
+// an empty name, which no configured remote can have.
+const remoteDirect = "direct"
+
 func NewDefaultRemote() RemoteConfig {
 	return RemoteConfig{
-		Timeout: constant.DefaultDialerTimeout, // default timeout
+		Timeout:        constant.DefaultDialerTimeout, // default timeout
+		HealthInterval: constant.DefaultHealthCheckInterval,
+		HealthTimeout:  constant.DefaultHealthCheckTimeout,
+		HealthRise:     constant.DefaultHealthCheckRise,
+		HealthFall:     constant.DefaultHealthCheckFall,
 	}
 }
 
@@ -234,12 +810,64 @@ func (c *RemoteConfig) valid() error {
 	if c.Name == "" {
 		return errors.New("no name specified")
 	}
-	if c.Server == "" {
-		return errors.New("no server specified")
-	}
-	if c.Port == 0 {
+	// a remote without server only lends its dialer to socks5 binds
+	if c.Network != "" {
+		if !c.Network.IsUnix() {
+			return fmt.Errorf("unsupported network: %s", c.Network)
+		}
+		if c.Port != 0 || c.PortEnd != 0 || len(c.Servers) != 0 {
+			return errors.New("unix remotes take a single socket path")
+		}
+	} else if c.Port == 0 && (c.PortEnd != 0 || len(c.Servers) != 0 || c.HealthCheck != "") {
 		return errors.New("no server port specified")
 	}
+	if c.PortEnd != 0 && c.PortEnd <= c.Port {
+		return errors.New("port range end must be greater than the start")
+	}
+	for _, s := range c.Servers {
+		if err := s.valid(); err != nil {
+			return err
+		}
+	}
+	if _, err := outbounds.NewBalancer(c.Balance); err != nil {
+		return err
+	}
+	if _, err := c.healthCheck(); err != nil {
+		return err
+	}
+	if c.Backup == c.Name {
+		return errors.New("remote can not be the backup of itself")
+	}
+	if c.Backup != "" && c.HealthCheck == "" {
+		// servers are only known to be down through their health checks
+		return errors.New("backup requires health_check")
+	}
+	if c.ProxyProtocol != "" {
+		if _, err := proxyproto.ParseVersion(c.ProxyProtocol); err != nil {
+			return err
+		}
+	}
+	if _, err := c.dnsClient(); err != nil {
+		return err
+	}
+	if c.TLS && c.Network == meta.ProtocolUnixgram {
+		return errors.New("tls is not supported on unixgram remotes")
+	}
+	if c.Via != "" {
+		if c.Network != "" {
+			return errors.New("via is not supported on unix remotes")
+		}
+		proxy, err := dialer.NewProxy(nil, dialer.ProxyConfig{URL: c.Via})
+		if err != nil {
+			return err
+		}
+		if dialer.IsStreamProxy(proxy) && c.HealthCheck == outbounds.HealthCheckUDP {
+			return errors.New("udp health checks are not supported through an http proxy")
+		}
+	}
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return errors.New("client certificate requires both client_cert and client_key")
+	}
 	if c.Timeout == 0 {
 		return errors.New("timeout must greater than 0")
 	}
@@ -251,12 +879,100 @@ func (c *RemoteConfig) IsValid() bool {
 	return c.valid() == nil
 }
 
+func (c RemoteConfig) equal(o RemoteConfig) bool {
+	c.Raw, o.Raw = "", ""
+	return reflect.DeepEqual(c, o)
+}
+
+func (c *RemoteConfig) healthCheck() (*outbounds.HealthCheck, error) {
+	if c.HealthCheck == "" {
+		return nil, nil
+	}
+	send, err := parsePayload(c.HealthSend)
+	if err != nil {
+		return nil, fmt.Errorf("health_send: %w", err)
+	}
+	expect, err := parsePayload(c.HealthExpect)
+	if err != nil {
+		return nil, fmt.Errorf("health_expect: %w", err)
+	}
+	hc := &outbounds.HealthCheck{
+		Type:     c.HealthCheck,
+		Interval: c.HealthInterval,
+		Timeout:  c.HealthTimeout,
+		Rise:     c.HealthRise,
+		Fall:     c.HealthFall,
+		Send:     send,
+		Expect:   expect,
+	}
+	if err := hc.Valid(); err != nil {
+		return nil, err
+	}
+	return hc, nil
+}
+
+// dnsClient returns the exchanger of the dns servers of this remote, nil
+// when it uses the default resolver.
+func (c *RemoteConfig) dnsClient() (resolve.Exchanger, error) {
+	if len(c.DNS) == 0 {
+		return nil, nil
+	}
+	var clients []resolve.Exchanger
+	for _, server := range c.DNS {
+		client, err := resolve.NewClient(net.Dialer{}, server)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	// a single server still goes through the group for dns_timeout
+	return resolve.NewGroup(clients, resolve.GroupOptions{
+		Policy:  c.DNSPolicy,
+		Timeout: c.DNSTimeout,
+	})
+}
+
+// viaHeader returns the headers sent to an http proxy.
+func (c *RemoteConfig) viaHeader() http.Header {
+	header := make(http.Header, len(c.ViaHeaders))
+	for name, value := range c.ViaHeaders {
+		header.Set(name, value)
+	}
+	return header
+}
+
+func parsePayload(s string) ([]byte, error) {
+	if hexStr, ok := strings.CutPrefix(s, "hex:"); ok {
+		return hex.DecodeString(hexStr)
+	}
+	return []byte(s), nil
+}
+
+// Upstreams returns every server of this remote, including the one
+// set by Server and Port.
+func (c *RemoteConfig) Upstreams() []ServerConfig {
+	var servers []ServerConfig
+	if c.Server != "" {
+		servers = append(servers, ServerConfig{Server: c.Server, Port: c.Port})
+	}
+	return append(servers, c.Servers...)
+}
+
 func (c *RemoteConfig) Parse(s string) error {
 	if s == "" {
 		return errors.New("remote: empty")
 	}
 
-	uu, err := url.Parse(s)
+	raw, portEnd := s, uint16(0)
+	socketPath, network, isUnix := unixSocketPath(s)
+	if !isUnix {
+		var err error
+		raw, portEnd, err = cutPortRange(s)
+		if err != nil {
+			return fmt.Errorf("remote(port): %w", err)
+		}
+	}
+	uu, err := url.Parse(raw)
 	if err != nil {
 		return fmt.Errorf("remote: %w", err)
 	}
@@ -265,8 +981,14 @@ func (c *RemoteConfig) Parse(s string) error {
 	nc.Raw = s
 	nc.Server = uu.Hostname()
 	nc.Name = uu.Scheme
+	nc.PortEnd = portEnd
 
-	if uu.Port() != "" {
+	if isUnix {
+		// name+unix:///path
+		nc.Name = strings.TrimSuffix(uu.Scheme, "+"+network.String())
+		nc.Network = network
+		nc.Server = socketPath
+	} else if uu.Port() != "" {
 		pp, err := strconv.ParseUint(uu.Port(), 10, 16)
 		if err != nil {
 			return fmt.Errorf("remote(port): %w", err)
@@ -282,8 +1004,29 @@ func (c *RemoteConfig) Parse(s string) error {
 		var val = v[pick]
 
 		switch k {
+		case "server":
+			for _, s := range v {
+				var server ServerConfig
+				if err := server.Parse(s); err != nil {
+					return fmt.Errorf("remote(server): %w", err)
+				}
+				nc.Servers = append(nc.Servers, server)
+			}
+		case "balance":
+			nc.Balance = val
 		case "dns":
-			nc.DNS = val
+			nc.DNS = nil
+			for _, item := range v {
+				nc.DNS = append(nc.DNS, meta.ParseStringList(item)...)
+			}
+		case "dns_policy":
+			nc.DNSPolicy = val
+		case "dns_timeout":
+			timeout, err := time.ParseDuration(val)
+			if err != nil {
+				return fmt.Errorf("remote(dns_timeout): expected duration, got %s", val)
+			}
+			nc.DNSTimeout = timeout
 		case "strategy":
 			strategy, err := meta.ParseStrategy(val)
 			if err != nil {
@@ -336,6 +1079,70 @@ func (c *RemoteConfig) Parse(s string) error {
 			nc.BindAddress6 = addr
 		case "name":
 			nc.Name = val
+		case "health_check":
+			nc.HealthCheck = val
+		case "health_interval", "health_timeout":
+			duration, err := time.ParseDuration(val)
+			if err != nil {
+				return fmt.Errorf("remote(%s): expected duration, got %s", k, val)
+			}
+			if k == "health_interval" {
+				nc.HealthInterval = duration
+			} else {
+				nc.HealthTimeout = duration
+			}
+		case "health_rise", "health_fall":
+			count, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("remote(%s): %w", k, err)
+			}
+			if k == "health_rise" {
+				nc.HealthRise = count
+			} else {
+				nc.HealthFall = count
+			}
+		case "health_send":
+			nc.HealthSend = val
+		case "health_expect":
+			nc.HealthExpect = val
+		case "backup":
+			nc.Backup = val
+		case "proxy_protocol":
+			nc.ProxyProtocol = val
+		case "tls", "insecure_skip_verify":
+			ok, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("remote(%s): expected bool, got %s", k, val)
+			}
+			if k == "tls" {
+				nc.TLS = ok
+			} else {
+				nc.InsecureSkipVerify = ok
+			}
+		case "sni":
+			nc.SNI = val
+		case "via":
+			nc.Via = val
+		case "via_headers":
+			nc.ViaHeaders = make(map[string]string)
+			for _, item := range v {
+				name, value, ok := strings.Cut(item, ":")
+				if !ok || name == "" {
+					return fmt.Errorf("remote(via_headers): expected name: value, got %s", item)
+				}
+				nc.ViaHeaders[name] = strings.TrimSpace(value)
+			}
+		case "ca_file":
+			nc.CAFile = val
+		case "client_cert":
+			nc.ClientCert = val
+		case "client_key":
+			nc.ClientKey = val
+		case "alpn":
+			nc.ALPN = nil
+			for _, item := range v {
+				nc.ALPN = append(nc.ALPN, meta.ParseStringList(item)...)
+			}
 		default:
 			return fmt.Errorf("remote: unknown option: %s", k)
 		}
@@ -376,3 +1183,71 @@ func (c *RemoteConfig) UnmarshalJSON(bs []byte) error {
 	*c = nc
 	return nil
 }
+
+type ServerConfig struct {
+	Server string `json:"server,omitempty"`
+	Port   uint16 `json:"port,omitempty"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+type _ServerConfig ServerConfig
+
+func (c *ServerConfig) valid() error {
+	if c.Server == "" {
+		return errors.New("no server specified")
+	}
+	if c.Port == 0 {
+		return fmt.Errorf("no port specified for %s", c.Server)
+	}
+	if c.Weight < 0 {
+		return fmt.Errorf("weight of %s can not be negative", c.Server)
+	}
+	return nil
+}
+
+// Parse parses a server in form of host:port[@weight].
+func (c *ServerConfig) Parse(s string) error {
+	var nc ServerConfig
+	if i := strings.LastIndexByte(s, '@'); i >= 0 {
+		weight, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return fmt.Errorf("server(weight): %w", err)
+		}
+		nc.Weight = weight
+		s = s[:i]
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+	pp, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("server(port): %w", err)
+	}
+	nc.Server = host
+	nc.Port = uint16(pp)
+	if err := nc.valid(); err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+	*c = nc
+	return nil
+}
+
+func (c *ServerConfig) UnmarshalJSON(bs []byte) error {
+	var nc ServerConfig
+	if len(bs) >= 2 && bs[0] == '"' && bs[len(bs)-1] == '"' {
+		if err := nc.Parse(string(bs[1 : len(bs)-1])); err != nil {
+			return err
+		}
+		*c = nc
+		return nil
+	}
+	if err := json.Unmarshal(bs, (*_ServerConfig)(&nc)); err != nil {
+		return err
+	}
+	if err := nc.valid(); err != nil {
+		return err
+	}
+	*c = nc
+	return nil
+}
@@ -11,9 +11,32 @@ const (
 	DefaultResolverReadTimeout = 5 * time.Second
 	DefaultUDPReadBufferSize   = 65507
 	DefaultUDPKeepAlive        = 60 * time.Second
+	DefaultUDPMaxSessions      = 4096
+
+	DefaultProxyProtocolTimeout = 5 * time.Second
+	DefaultRejectLogInterval    = 10 * time.Second
+	DefaultACLWatchInterval     = 5 * time.Second
+	DefaultHostsWatchInterval   = 5 * time.Second
+	DefaultRateLimiterSize      = 65536 // tracked sources
+	DefaultTLSHandshakeTimeout  = 10 * time.Second
+	DefaultCertWatchInterval    = 30 * time.Second
+	DefaultRouteTimeout         = 5 * time.Second
+	DefaultRouteHeaderSize      = 16 * 1024
+	DefaultSocksTimeout         = 10 * time.Second
+
+	DefaultHealthCheckInterval = 10 * time.Second
+	DefaultHealthCheckTimeout  = 3 * time.Second
+	DefaultHealthCheckRise     = 2
+	DefaultHealthCheckFall     = 3
 
 	DefaultResolverCacheTTL  = 300 // seconds
 	DefaultResolverCacheSize = 512
+	DefaultDNSUDPSize        = 1232 // advertised with EDNS0, fits the common MTUs
+	DefaultDNSServerDownTime = 30 * time.Second
+)
+
+const (
+	DefaultConfigWatchInterval = 2 * time.Second
 )
 
 const (
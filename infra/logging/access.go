@@ -0,0 +1,179 @@
+package logging
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CloseReasonClientEOF   = "client_eof"
+	CloseReasonUpstreamEOF = "upstream_eof"
+	CloseReasonTTL         = "ttl"
+	CloseReasonEvicted     = "evicted"
+	CloseReasonError       = "error"
+	CloseReasonShutdown    = "shutdown"
+	// the session table of the bind was full, the session was never relayed
+	CloseReasonSessionLimit = "session_limit"
+)
+
+const AccessFormatJSON = "json"
+
+// AccessRecord describes one finished TCP connection or UDP session.
+type AccessRecord struct {
+	Network  string
+	Bind     string
+	Remote   string
+	Client   string
+	Upstream string
+	Start    time.Time
+	Duration time.Duration
+
+	UploadBytes     int64
+	DownloadBytes   int64
+	UploadPackets   int64
+	DownloadPackets int64
+
+	Reason string
+}
+
+func (r *AccessRecord) fields() map[string]string {
+	return map[string]string{
+		"network":          r.Network,
+		"bind":             r.Bind,
+		"remote":           r.Remote,
+		"client":           r.Client,
+		"upstream":         r.Upstream,
+		"start":            r.Start.Format(time.RFC3339Nano),
+		"duration":         r.Duration.String(),
+		"upload_bytes":     strconv.FormatInt(r.UploadBytes, 10),
+		"download_bytes":   strconv.FormatInt(r.DownloadBytes, 10),
+		"upload_packets":   strconv.FormatInt(r.UploadPackets, 10),
+		"download_packets": strconv.FormatInt(r.DownloadPackets, 10),
+		"reason":           r.Reason,
+	}
+}
+
+// AccessLogger writes access records to its own sink, a nil or disabled
+// AccessLogger discards every record.
+type AccessLogger struct {
+	mu     sync.Mutex
+	writer io.Writer // nil when disabled
+	closer io.Closer
+	format string
+}
+
+// NewAccessLogger opens the access log at path, which may also be "stdout"
+// or "stderr", or is empty for a disabled one. format is either "json" or
+// a line template containing {field} placeholders,
+// e.g. "{start} {client} -> {upstream} {reason}".
+func NewAccessLogger(path string, format string) (*AccessLogger, error) {
+	l := &AccessLogger{}
+	if err := l.Reopen(path, format); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reopen switches l over to the access log at path, the current one is
+// kept on error and closed otherwise.
+func (l *AccessLogger) Reopen(path string, format string) error {
+	var (
+		writer io.Writer
+		closer io.Closer
+	)
+	switch path {
+	case "":
+	case "stdout":
+		writer = os.Stdout
+	case "stderr":
+		writer = os.Stderr
+	default:
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("access log: %w", err)
+		}
+		writer, closer = f, f
+	}
+
+	l.mu.Lock()
+	previous := l.closer
+	l.writer, l.closer, l.format = writer, closer, cmp.Or(format, AccessFormatJSON)
+	l.mu.Unlock()
+	if previous != nil {
+		return previous.Close()
+	}
+	return nil
+}
+
+// Enabled reports whether records are written anywhere.
+func (l *AccessLogger) Enabled() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.writer != nil
+}
+
+func (l *AccessLogger) Log(record AccessRecord) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.writer == nil {
+		return
+	}
+	var line []byte
+	if l.format == AccessFormatJSON {
+		fields := record.fields()
+		line, _ = json.Marshal(struct {
+			Network         string `json:"network"`
+			Bind            string `json:"bind"`
+			Remote          string `json:"remote"`
+			Client          string `json:"client"`
+			Upstream        string `json:"upstream,omitempty"`
+			Start           string `json:"start"`
+			Duration        string `json:"duration"`
+			UploadBytes     int64  `json:"upload_bytes"`
+			DownloadBytes   int64  `json:"download_bytes"`
+			UploadPackets   int64  `json:"upload_packets,omitempty"`
+			DownloadPackets int64  `json:"download_packets,omitempty"`
+			Reason          string `json:"reason"`
+		}{
+			record.Network, record.Bind, record.Remote, record.Client, record.Upstream,
+			fields["start"], fields["duration"],
+			record.UploadBytes, record.DownloadBytes, record.UploadPackets, record.DownloadPackets,
+			record.Reason,
+		})
+	} else {
+		var pairs []string
+		for k, v := range record.fields() {
+			pairs = append(pairs, "{"+k+"}", v)
+		}
+		line = []byte(strings.NewReplacer(pairs...).Replace(l.format))
+	}
+	line = append(line, '\n')
+	l.writer.Write(line)
+}
+
+func (l *AccessLogger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	closer := l.closer
+	l.writer, l.closer = nil, nil
+	if closer == nil {
+		return nil
+	}
+	return closer.Close()
+}
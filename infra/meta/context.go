@@ -0,0 +1,28 @@
+package meta
+
+import (
+	"context"
+	"net/netip"
+)
+
+// Metadata describes the client side of a relayed connection.
+type Metadata struct {
+	// Source is the address of the client.
+	Source netip.AddrPort
+	// Destination is the local address the client connected to.
+	Destination netip.AddrPort
+	// PortOffsets is added to the port of the server dialed for the client,
+	// by the name of the remote, as a backup maps the ports on its own.
+	PortOffsets map[string]uint16
+}
+
+type metadataKey struct{}
+
+func ContextWithMetadata(ctx context.Context, metadata Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, metadata)
+}
+
+func MetadataFromContext(ctx context.Context) (Metadata, bool) {
+	metadata, ok := ctx.Value(metadataKey{}).(Metadata)
+	return metadata, ok
+}
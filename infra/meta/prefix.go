@@ -0,0 +1,90 @@
+package meta
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// PrefixList is a list of CIDR prefixes, bare addresses are accepted
+// as single-address prefixes.
+type PrefixList []netip.Prefix
+
+func (l PrefixList) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range l {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePrefixList parses a comma separated list of prefixes or addresses.
+func ParsePrefixList(s string) (PrefixList, error) {
+	var l PrefixList
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		prefix, err := ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, prefix)
+	}
+	return l, nil
+}
+
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if prefix.Addr().Is4In6() {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address or prefix: %s", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func (l *PrefixList) UnmarshalJSON(bs []byte) error {
+	// accept
+	// // "10.0.0.0/8,192.168.1.1"
+	// // ["10.0.0.0/8", "192.168.1.1"]
+	if len(bs) < 2 {
+		return errors.New("too short")
+	}
+	if bs[0] == '"' {
+		var s string
+		if err := json.Unmarshal(bs, &s); err != nil {
+			return err
+		}
+		nl, err := ParsePrefixList(s)
+		if err != nil {
+			return err
+		}
+		*l = nl
+		return nil
+	}
+	var items []string
+	if err := json.Unmarshal(bs, &items); err != nil {
+		return err
+	}
+	nl, err := ParsePrefixList(strings.Join(items, ","))
+	if err != nil {
+		return err
+	}
+	*l = nl
+	return nil
+}
@@ -14,6 +14,9 @@ const (
 	ProtocolTCP Protocol = "tcp"
 	ProtocolUDP Protocol = "udp"
 	ProtocolIP  Protocol = "ip"
+
+	ProtocolUnix     Protocol = "unix"
+	ProtocolUnixgram Protocol = "unixgram"
 )
 
 func (p Protocol) String() string {
@@ -26,13 +29,23 @@ func ParseProtocol(protocol string) Protocol {
 	}
 	pp := Protocol(protocol)
 	switch pp {
-	case ProtocolTCP, ProtocolUDP, ProtocolIP:
+	case ProtocolTCP, ProtocolUDP, ProtocolIP, ProtocolUnix, ProtocolUnixgram:
 		return pp
 	default:
 		return ""
 	}
 }
 
+// IsUnix reports whether p is a unix domain socket protocol.
+func (p Protocol) IsUnix() bool {
+	return p == ProtocolUnix || p == ProtocolUnixgram
+}
+
+// IsStream reports whether p carries a byte stream rather than datagrams.
+func (p Protocol) IsStream() bool {
+	return p == ProtocolTCP || p == ProtocolUnix
+}
+
 type ProtocolList []Protocol
 
 var emptyProtocolList = ProtocolList{}
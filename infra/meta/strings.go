@@ -0,0 +1,45 @@
+package meta
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// StringList is a list of strings, written as an array or a comma
+// separated string.
+type StringList []string
+
+// ParseStringList parses a comma separated list, empty items are skipped.
+func ParseStringList(s string) StringList {
+	var l StringList
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			l = append(l, item)
+		}
+	}
+	return l
+}
+
+func (l *StringList) UnmarshalJSON(bs []byte) error {
+	// accept
+	// // "h2,http/1.1"
+	// // ["h2", "http/1.1"]
+	if len(bs) < 2 {
+		return errors.New("too short")
+	}
+	if bs[0] == '"' {
+		var s string
+		if err := json.Unmarshal(bs, &s); err != nil {
+			return err
+		}
+		*l = ParseStringList(s)
+		return nil
+	}
+	var items []string
+	if err := json.Unmarshal(bs, &items); err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
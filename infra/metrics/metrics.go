@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	TypeCounter = "counter"
+	TypeGauge   = "gauge"
+)
+
+// Registry holds metric families and exposes them in the Prometheus text format.
+type Registry struct {
+	mu       sync.Mutex
+	families []*Vec
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Counter(name, help string, labels ...string) *Vec {
+	return r.register(name, help, TypeCounter, labels)
+}
+
+func (r *Registry) Gauge(name, help string, labels ...string) *Vec {
+	return r.register(name, help, TypeGauge, labels)
+}
+
+func (r *Registry) register(name, help, typ string, labels []string) *Vec {
+	v := &Vec{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+	r.mu.Lock()
+	r.families = append(r.families, v)
+	r.mu.Unlock()
+	return v
+}
+
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.writeTo(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+// Vec is a metric family partitioned by label values.
+type Vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.RWMutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  atomic.Int64
+}
+
+// With returns the value of the series with the given label values,
+// which must match the label names of the family in count and order.
+func (v *Vec) With(values ...string) *atomic.Int64 {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\x00")
+
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return &s.value
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok = v.series[key]; !ok {
+		s = &series{values: slices.Clone(values)}
+		v.series[key] = s
+	}
+	return &s.value
+}
+
+func (v *Vec) writeTo(w *bufio.Writer) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	v.mu.RUnlock()
+	slices.Sort(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ)
+	for _, k := range keys {
+		v.mu.RLock()
+		s := v.series[k]
+		v.mu.RUnlock()
+
+		w.WriteString(v.name)
+		if len(v.labels) > 0 {
+			w.WriteByte('{')
+			for i, label := range v.labels {
+				if i > 0 {
+					w.WriteByte(',')
+				}
+				fmt.Fprintf(w, "%s=\"%s\"", label, escaper.Replace(s.values[i]))
+			}
+			w.WriteByte('}')
+		}
+		fmt.Fprintf(w, " %d\n", s.value.Load())
+	}
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,156 @@
+package acl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/daminit/traffics-cli/infra/meta"
+)
+
+type Options struct {
+	Allow     meta.PrefixList
+	Deny      meta.PrefixList
+	AllowFile string
+	DenyFile  string
+}
+
+type rules struct {
+	allow meta.PrefixList
+	deny  meta.PrefixList
+}
+
+// ACL decides whether a source address is accepted. Deny rules win over
+// allow rules, and an empty allow list accepts everyone not denied.
+type ACL struct {
+	options Options
+	rules   atomic.Pointer[rules]
+	modTime [2]time.Time // allow file, deny file
+}
+
+func New(options Options) (*ACL, error) {
+	a := &ACL{options: options}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *ACL) Allowed(addr netip.Addr) bool {
+	r := a.rules.Load()
+	if r.deny.Contains(addr) {
+		return false
+	}
+	return len(r.allow) == 0 || r.allow.Contains(addr)
+}
+
+// Reload reads the allow and deny files again, the current rules are kept on error.
+func (a *ACL) Reload() error {
+	r := &rules{
+		allow: append(meta.PrefixList{}, a.options.Allow...),
+		deny:  append(meta.PrefixList{}, a.options.Deny...),
+	}
+	var modTime [2]time.Time
+	for i, file := range []string{a.options.AllowFile, a.options.DenyFile} {
+		if file == "" {
+			continue
+		}
+		list, mod, err := readFile(file)
+		if err != nil {
+			return err
+		}
+		modTime[i] = mod
+		if i == 0 {
+			r.allow = append(r.allow, list...)
+		} else {
+			r.deny = append(r.deny, list...)
+		}
+	}
+	a.modTime = modTime
+	a.rules.Store(r)
+	return nil
+}
+
+// Watch reloads the rules whenever a file changes until ctx is done. A
+// failed reload is reported once, until the files change again.
+func (a *ACL) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	if a.options.AllowFile == "" && a.options.DenyFile == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var failed *[2]time.Time // the files the last reload failed on
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		latest := a.stat()
+		if sameTimes(latest, a.modTime) || (failed != nil && sameTimes(latest, *failed)) {
+			continue
+		}
+		if err := a.Reload(); err != nil {
+			failed = &latest
+			onError(err)
+			continue
+		}
+		failed = nil
+	}
+}
+
+// stat returns the modification time of the allow and deny files, it is
+// zero for a missing one.
+func (a *ACL) stat() [2]time.Time {
+	var modTime [2]time.Time
+	for i, file := range []string{a.options.AllowFile, a.options.DenyFile} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			modTime[i] = info.ModTime()
+		}
+	}
+	return modTime
+}
+
+func sameTimes(x, y [2]time.Time) bool {
+	return x[0].Equal(y[0]) && x[1].Equal(y[1])
+}
+
+// readFile reads one prefix or address per line, '#' starts a comment.
+func readFile(name string) (meta.PrefixList, time.Time, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("acl: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("acl: %w", err)
+	}
+
+	var list meta.PrefixList
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		prefix, err := meta.ParsePrefix(text)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("acl: %s:%d: %w", name, line, err)
+		}
+		list = append(list, prefix)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("acl: %w", err)
+	}
+	return list, info.ModTime(), nil
+}
@@ -0,0 +1,15 @@
+package dialer
+
+import "syscall"
+
+// autobindUnix binds a unix socket to a kernel chosen abstract address
+// before it connects, so the peer of a datagram socket is able to reply.
+func autobindUnix(_, _ string, c syscall.RawConn) error {
+	var err error
+	if controlErr := c.Control(func(fd uintptr) {
+		err = syscall.Bind(int(fd), &syscall.SockaddrUnix{})
+	}); controlErr != nil {
+		return controlErr
+	}
+	return err
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package dialer
+
+import "syscall"
+
+// autobindUnix is a no-op as only Linux supports autobind, datagram
+// servers are unable to reply to such clients.
+func autobindUnix(_, _ string, _ syscall.RawConn) error {
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"net/netip"
 	"runtime"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/daminit/traffics-cli/infra/constant"
@@ -19,6 +20,11 @@ import (
 	"github.com/sagernet/sing/common/metadata"
 )
 
+var (
+	ErrResolve      = errors.New("dialer: resolve failed")
+	ErrTLSHandshake = errors.New("dialer: tls handshake failed")
+)
+
 type Dialer interface {
 	DialContext(ctx context.Context, network, address string) (net.Conn, error)
 }
@@ -102,8 +108,15 @@ func NewDefault(config DialConfig) (*DefaultDialer, error) {
 		udpDialer6.LocalAddr = &net.UDPAddr{IP: bind.AsSlice()}
 	}
 
+	// socket options above are meaningless for unix sockets
+	unixDialer := net.Dialer{Timeout: dialer.Timeout}
+	unixgramDialer := unixDialer
+	unixgramDialer.Control = autobindUnix
+
 	return &DefaultDialer{
 		defaultDialer:   dialer,
+		unixDialer:      unixDialer,
+		unixgramDialer:  unixgramDialer,
 		dialer4:         dialer4,
 		dialer6:         dialer6,
 		udpDialer4:      udpDialer4,
@@ -122,6 +135,9 @@ type DefaultDialer struct {
 	udpDialer4 net.Dialer
 	udpDialer6 net.Dialer
 
+	unixDialer     net.Dialer
+	unixgramDialer net.Dialer
+
 	udpAddr4 string
 	udpAddr6 string
 
@@ -132,6 +148,10 @@ type DefaultDialer struct {
 func (d *DefaultDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
 	switch network {
 	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	case "unix":
+		return d.unixDialer.DialContext(ctx, network, address)
+	case "unixgram":
+		return d.unixgramDialer.DialContext(ctx, network, address)
 	default:
 		// fallback to default dialer
 		return d.defaultDialer.DialContext(ctx, network, address)
@@ -154,7 +174,7 @@ func (d *DefaultDialer) DialContext(ctx context.Context, network, address string
 	}
 	a, aaaa, err := d.resolver.Lookup(ctx, host, d.resolveStrategy)
 	if err != nil {
-		return nil, fmt.Errorf("dialer: resolve address for %s failed: %w", address, err)
+		return nil, fmt.Errorf("%w for %s: %w", ErrResolve, address, err)
 	}
 
 	return d.DialParallel(ctx, network, d.resolveStrategy, a, aaaa, uint16(portNum))
@@ -327,6 +347,29 @@ func (d *DefaultDialer) DialParallel(ctx context.Context, network string, strate
 	return nil, fmt.Errorf("dialer: all parallel dials failed for both IPv4 and IPv6")
 }
 
+// FailureReason classifies a dial error into a short reason.
+func FailureReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrResolve):
+		return "resolve"
+	case errors.Is(err, ErrTLSHandshake):
+		return "tls"
+	case errors.Is(err, ErrProxy):
+		return "proxy"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return "unreachable"
+	default:
+		return "error"
+	}
+}
+
 func filterAddressByNetwork(network meta.Network, addr []netip.Addr) []netip.Addr {
 	switch {
 	case network.Version == meta.NetworkVersionDual:
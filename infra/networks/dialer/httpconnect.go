@@ -0,0 +1,87 @@
+package dialer
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sagernet/sing/common/buf"
+	sbufio "github.com/sagernet/sing/common/bufio"
+	N "github.com/sagernet/sing/common/network"
+)
+
+// httpDialer dials tcp with an HTTP CONNECT request, the proxy resolves
+// domain names.
+type httpDialer struct {
+	dialer Dialer
+	server string
+	tls    *tls.Config // nil for plain http proxies
+	header http.Header
+	config ProxyConfig
+}
+
+// IsStreamProxy reports whether d reaches destinations through a proxy
+// which only carries tcp.
+func IsStreamProxy(d Dialer) bool {
+	_, ok := d.(*httpDialer)
+	return ok
+}
+
+func (d *httpDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if N.NetworkName(network) != N.NetworkTCP {
+		return nil, fmt.Errorf("dialer: http proxy: unsupported network: %s", network)
+	}
+	conn, err := d.dialer.DialContext(ctx, N.NetworkTCP, d.server)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(d.config.Timeout))
+	if d.tls != nil {
+		tlsConn := tls.Client(conn, d.tls)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w with %s: %w", ErrProxy, d.server, err)
+		}
+		conn = tlsConn
+	}
+	conn, err = d.connect(conn, address)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w with %s: %w", ErrProxy, d.server, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// connect asks the proxy for a tunnel to address.
+func (d *httpDialer) connect(conn net.Conn, address string) (net.Conn, error) {
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: d.header,
+	}
+	if err := request.Write(conn); err != nil {
+		return conn, err
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		return conn, err
+	}
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return conn, fmt.Errorf("connect %s: %s", address, response.Status)
+	}
+	// the server may speak first, keep what came along with the response
+	if n := reader.Buffered(); n > 0 {
+		cached, _ := reader.Peek(n)
+		return sbufio.NewCachedConn(conn, buf.As(cached)), nil
+	}
+	return conn, nil
+}
@@ -0,0 +1,81 @@
+package dialer
+
+import (
+	"cmp"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/daminit/traffics-cli/infra/constant"
+	"github.com/daminit/traffics-cli/infra/meta"
+)
+
+var ErrProxy = errors.New("dialer: proxy handshake failed")
+
+type ProxyConfig struct {
+	// URL of the proxy server, socks5://[user:pass@]host:port, socks5h://
+	// sends domain names to the proxy unresolved. http:// and https://
+	// proxies are asked with CONNECT and carry tcp only.
+	URL    string
+	Header http.Header // sent to http proxies
+
+	Timeout  time.Duration // of the handshake with the proxy
+	Resolver Resolver      // resolves destinations when the proxy does not
+	Strategy meta.Strategy
+}
+
+// NewProxy returns a dialer reaching destinations through a proxy server,
+// which is dialed by d.
+func NewProxy(d Dialer, config ProxyConfig) (Dialer, error) {
+	proxyURL, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("dialer: invalid proxy url: %w", err)
+	}
+	if _, port, err := net.SplitHostPort(proxyURL.Host); err != nil || port == "" {
+		return nil, fmt.Errorf("dialer: invalid proxy address: %s", proxyURL.Host)
+	}
+	if config.Resolver == nil {
+		config.Resolver = DefaultResolver
+	}
+	config.Timeout = cmp.Or(config.Timeout, constant.DefaultDialerTimeout)
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		password, _ := proxyURL.User.Password()
+		return &socks5Dialer{
+			dialer:    d,
+			server:    proxyURL.Host,
+			username:  proxyURL.User.Username(),
+			password:  password,
+			remoteDNS: proxyURL.Scheme == "socks5h",
+			config:    config,
+		}, nil
+	case "http", "https":
+		header := config.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			credential := proxyURL.User.Username() + ":" + password
+			header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credential)))
+		}
+		proxy := &httpDialer{
+			dialer: d,
+			server: proxyURL.Host,
+			header: header,
+			config: config,
+		}
+		if proxyURL.Scheme == "https" {
+			proxy.tls = &tls.Config{ServerName: proxyURL.Hostname()}
+		}
+		return proxy, nil
+	default:
+		return nil, fmt.Errorf("dialer: unsupported proxy scheme: %s", proxyURL.Scheme)
+	}
+}
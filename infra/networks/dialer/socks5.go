@@ -0,0 +1,89 @@
+package dialer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/daminit/traffics-cli/infra/meta"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/protocol/socks"
+	"github.com/sagernet/sing/protocol/socks/socks5"
+)
+
+// socks5Dialer dials tcp with CONNECT and udp with UDP ASSOCIATE.
+type socks5Dialer struct {
+	dialer    Dialer
+	server    string
+	username  string
+	password  string
+	remoteDNS bool
+	config    ProxyConfig
+}
+
+func (d *socks5Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var command byte
+	switch N.NetworkName(network) {
+	case N.NetworkTCP:
+		command = socks5.CommandConnect
+	case N.NetworkUDP:
+		command = socks5.CommandUDPAssociate
+	default:
+		return nil, fmt.Errorf("dialer: socks5: unsupported network: %s", network)
+	}
+	destination, err := d.destination(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.dialer.DialContext(ctx, N.NetworkTCP, d.server)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(d.config.Timeout))
+	response, err := socks.ClientHandshake5(conn, command, destination, d.username, d.password)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w with %s: %w", ErrProxy, d.server, err)
+	}
+	conn.SetDeadline(time.Time{})
+	if command == socks5.CommandConnect {
+		return conn, nil
+	}
+
+	// the relay is on the proxy host when the proxy does not tell
+	relay := response.Bind
+	if !relay.IsFqdn() && (!relay.Addr.IsValid() || relay.Addr.IsUnspecified()) {
+		relay.Addr = M.AddrPortFromNet(conn.RemoteAddr()).Addr()
+	}
+	udpConn, err := d.dialer.DialContext(ctx, N.NetworkUDP, relay.String())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// the association lasts as long as conn
+	return socks.NewAssociatePacketConn(udpConn, destination, conn), nil
+}
+
+// destination resolves the domain name of address unless the proxy does.
+func (d *socks5Dialer) destination(ctx context.Context, address string) (M.Socksaddr, error) {
+	destination := M.ParseSocksaddr(address)
+	if !destination.IsFqdn() || d.remoteDNS {
+		return destination, nil
+	}
+	a, aaaa, err := d.config.Resolver.Lookup(ctx, destination.Fqdn, d.config.Strategy)
+	if err != nil {
+		return M.Socksaddr{}, fmt.Errorf("%w for %s: %w", ErrResolve, address, err)
+	}
+	addresses := slices.Concat(a, aaaa)
+	if d.config.Strategy == meta.StrategyPreferIPv6 || d.config.Strategy == meta.StrategyIPv6Only {
+		addresses = slices.Concat(aaaa, a)
+	}
+	if len(addresses) == 0 {
+		return M.Socksaddr{}, fmt.Errorf("%w for %s: no address", ErrResolve, address)
+	}
+	return M.SocksaddrFromNetIP(netip.AddrPortFrom(addresses[0], destination.Port)), nil
+}
@@ -0,0 +1,138 @@
+package limit
+
+import (
+	"errors"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing/common/cache"
+)
+
+var (
+	ErrMaxConns      = errors.New("limit: too many connections")
+	ErrMaxConnsPerIP = errors.New("limit: too many connections from source")
+)
+
+// ConnLimiter bounds concurrent connections in total and per source address,
+// a zero maximum means unlimited.
+type ConnLimiter struct {
+	max      int
+	maxPerIP int
+
+	mu    sync.Mutex
+	total int
+	perIP map[netip.Addr]int
+}
+
+func NewConnLimiter(max, maxPerIP int) *ConnLimiter {
+	return &ConnLimiter{
+		max:      max,
+		maxPerIP: maxPerIP,
+		perIP:    make(map[netip.Addr]int),
+	}
+}
+
+// Acquire reserves a connection for addr, it must be paired with Release on success.
+func (l *ConnLimiter) Acquire(addr netip.Addr) error {
+	if err := l.AcquireTotal(); err != nil {
+		return err
+	}
+	if err := l.AcquireSource(addr); err != nil {
+		l.ReleaseTotal()
+		return err
+	}
+	return nil
+}
+
+// AcquireTotal reserves a connection whose source is not known yet, the
+// source is reserved with AcquireSource later. It must be paired with
+// ReleaseTotal, or Release once the source is reserved as well.
+func (l *ConnLimiter) AcquireTotal() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.total >= l.max {
+		return ErrMaxConns
+	}
+	l.total++
+	return nil
+}
+
+// AcquireSource reserves the source addr of a connection reserved by
+// AcquireTotal.
+func (l *ConnLimiter) AcquireSource(addr netip.Addr) error {
+	addr = addr.Unmap()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxPerIP > 0 && l.perIP[addr] >= l.maxPerIP {
+		return ErrMaxConnsPerIP
+	}
+	if l.maxPerIP > 0 {
+		l.perIP[addr]++
+	}
+	return nil
+}
+
+func (l *ConnLimiter) ReleaseTotal() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+}
+
+func (l *ConnLimiter) Release(addr netip.Addr) {
+	addr = addr.Unmap()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.maxPerIP > 0 {
+		if l.perIP[addr] <= 1 {
+			delete(l.perIP, addr)
+		} else {
+			l.perIP[addr]--
+		}
+	}
+}
+
+type bucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is a token bucket per source address.
+type RateLimiter struct {
+	rate    float64 // tokens per second
+	burst   float64
+	buckets *cache.LruCache[netip.Addr, *bucket]
+}
+
+// NewRateLimiter allows rate events per second per source, with bursts of
+// up to rate (at least one) events. At most size sources are tracked.
+func NewRateLimiter(rate float64, size int) *RateLimiter {
+	return &RateLimiter{
+		rate:  rate,
+		burst: max(rate, 1),
+		buckets: cache.New[netip.Addr, *bucket](
+			cache.WithSize[netip.Addr, *bucket](size),
+			cache.WithAge[netip.Addr, *bucket](60),
+			cache.WithUpdateAgeOnGet[netip.Addr, *bucket](),
+		),
+	}
+}
+
+func (l *RateLimiter) Allow(addr netip.Addr) bool {
+	now := time.Now()
+	b, _ := l.buckets.LoadOrStore(addr.Unmap(), func() *bucket {
+		return &bucket{tokens: l.burst, last: now}
+	})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/metacubex/tfo-go"
 	"github.com/sagernet/sing/common/control"
 	"net"
+	"os"
 	"strconv"
 )
 
@@ -23,6 +24,10 @@ type Options struct {
 
 	// udp
 	UDPFragment bool
+
+	// unix, ignored by abstract sockets
+	UnixMode  os.FileMode // zero keeps the default
+	UnixOwner string      // user[:group]
 }
 
 type Listener struct {
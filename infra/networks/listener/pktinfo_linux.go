@@ -0,0 +1,52 @@
+package listener
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+
+	"golang.org/x/sys/unix"
+)
+
+// EnablePacketInfo makes conn report the local address every datagram was
+// sent to, see PacketDestination.
+func EnablePacketInfo(conn *net.UDPConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var err4, err6 error
+	if controlErr := raw.Control(func(fd uintptr) {
+		// a dual stack socket needs both, one of them fails on the others
+		err4 = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_PKTINFO, 1)
+		err6 = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_RECVPKTINFO, 1)
+	}); controlErr != nil {
+		return controlErr
+	}
+	if err4 != nil && err6 != nil {
+		return errors.Join(err4, err6)
+	}
+	return nil
+}
+
+// PacketDestination returns the local address found in the control
+// messages oob of a datagram, it is invalid when there is none.
+func PacketDestination(oob []byte) netip.Addr {
+	messages, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return netip.Addr{}
+	}
+	for _, m := range messages {
+		switch {
+		case m.Header.Level == unix.IPPROTO_IP && m.Header.Type == unix.IP_PKTINFO &&
+			len(m.Data) >= unix.SizeofInet4Pktinfo:
+			// ifindex(4) spec_dst(4) addr(4)
+			return netip.AddrFrom4([4]byte(m.Data[8:12]))
+		case m.Header.Level == unix.IPPROTO_IPV6 && m.Header.Type == unix.IPV6_PKTINFO &&
+			len(m.Data) >= unix.SizeofInet6Pktinfo:
+			// addr(16) ifindex(4)
+			return netip.AddrFrom16([16]byte(m.Data[:16])).Unmap()
+		}
+	}
+	return netip.Addr{}
+}
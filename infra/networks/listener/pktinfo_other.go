@@ -0,0 +1,18 @@
+//go:build !linux
+
+package listener
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+)
+
+// EnablePacketInfo is only supported on Linux.
+func EnablePacketInfo(_ *net.UDPConn) error {
+	return errors.ErrUnsupported
+}
+
+func PacketDestination(_ []byte) netip.Addr {
+	return netip.Addr{}
+}
@@ -0,0 +1,139 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IsAbstract reports whether path names a socket in the Linux abstract
+// namespace, which is written with a leading '@'.
+func IsAbstract(path string) bool {
+	return strings.HasPrefix(path, "@")
+}
+
+// ParseMode parses an octal file mode like "0660".
+func ParseMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid file mode: %s", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// ParseOwner parses "user", "user:group" or ":group", where user and group
+// are names or numeric ids. An omitted part is returned as -1.
+func ParseOwner(s string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	userName, groupName, _ := strings.Cut(s, ":")
+	if userName != "" {
+		if uid, err = strconv.Atoi(userName); err != nil {
+			u, err := user.Lookup(userName)
+			if err != nil {
+				return -1, -1, err
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if groupName != "" {
+		if gid, err = strconv.Atoi(groupName); err != nil {
+			g, err := user.LookupGroup(groupName)
+			if err != nil {
+				return -1, -1, err
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
+
+func (l *Listener) ListenUnix(ctx context.Context, path string) (net.Listener, error) {
+	if err := prepareUnix("unix", path); err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	var listenConfig net.ListenConfig
+	listener, err := listenConfig.Listen(ctx, "unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	if err = l.setUnixPermission(path); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	return listener, nil
+}
+
+// ListenUnixgram listens on a unix datagram socket, unlike ListenUnix the
+// socket file is not removed when the connection is closed.
+func (l *Listener) ListenUnixgram(ctx context.Context, path string) (*net.UnixConn, error) {
+	if err := prepareUnix("unixgram", path); err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	var listenConfig net.ListenConfig
+	packetConn, err := listenConfig.ListenPacket(ctx, "unixgram", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	if err = l.setUnixPermission(path); err != nil {
+		packetConn.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	return packetConn.(*net.UnixConn), nil
+}
+
+func (l *Listener) setUnixPermission(path string) error {
+	if IsAbstract(path) {
+		return nil
+	}
+	if l.options.UnixMode != 0 {
+		if err := os.Chmod(path, l.options.UnixMode); err != nil {
+			return err
+		}
+	}
+	if l.options.UnixOwner != "" {
+		uid, gid, err := ParseOwner(l.options.UnixOwner)
+		if err != nil {
+			return err
+		}
+		if err = os.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareUnix removes the socket file left at path by a previous process,
+// a socket still accepting connections is left alone.
+func prepareUnix(network, path string) error {
+	if IsAbstract(path) {
+		if runtime.GOOS != "linux" {
+			return errors.New("abstract unix sockets are only supported on Linux")
+		}
+		return nil
+	}
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	conn, err := net.DialTimeout(network, path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,74 @@
+package proxyproto
+
+import (
+	"net"
+
+	M "github.com/sagernet/sing/common/metadata"
+)
+
+// WriteHeader writes the header to a stream connection.
+func WriteHeader(conn net.Conn, version Version, header Header) error {
+	b, err := header.Append(nil, version)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(b)
+	return err
+}
+
+// PacketConn prefixes every written datagram with a v2 header.
+type PacketConn struct {
+	net.Conn
+	header []byte
+}
+
+func NewPacketConn(conn net.Conn, header Header) *PacketConn {
+	return &PacketConn{
+		Conn:   conn,
+		header: header.appendV2(nil),
+	}
+}
+
+func (c *PacketConn) Write(p []byte) (int, error) {
+	b := make([]byte, 0, len(c.header)+len(p))
+	b = append(append(b, c.header...), p...)
+	if _, err := c.Conn.Write(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Conn is a connection whose addresses are the ones conveyed by a header.
+type Conn struct {
+	net.Conn
+	source      net.Addr
+	destination net.Addr
+}
+
+func NewConn(conn net.Conn, header Header) *Conn {
+	return &Conn{
+		Conn:        conn,
+		source:      M.SocksaddrFromNetIP(header.Source).TCPAddr(),
+		destination: M.SocksaddrFromNetIP(header.Destination).TCPAddr(),
+	}
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.source
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.destination
+}
+
+func (c *Conn) Upstream() any {
+	return c.Conn
+}
+
+func (c *Conn) ReaderReplaceable() bool {
+	return true
+}
+
+func (c *Conn) WriterReplaceable() bool {
+	return true
+}
@@ -0,0 +1,128 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strconv"
+
+	"github.com/daminit/traffics-cli/infra/meta"
+)
+
+type Version uint8
+
+const (
+	Version1 Version = 1
+	Version2 Version = 2
+)
+
+func (v Version) String() string {
+	return "v" + strconv.Itoa(int(v))
+}
+
+func ParseVersion(s string) (Version, error) {
+	switch s {
+	case "v1", "1":
+		return Version1, nil
+	case "v2", "2":
+		return Version2, nil
+	default:
+		return 0, fmt.Errorf("proxyproto: unknown version: %s", s)
+	}
+}
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	v2CommandLocal = 0x20
+	v2CommandProxy = 0x21
+
+	v2FamilyUnspec = 0x00
+	v2FamilyInet   = 0x10
+	v2FamilyInet6  = 0x20
+
+	v2TransportStream = 0x01
+	v2TransportDgram  = 0x02
+)
+
+// Header is the information conveyed by a PROXY protocol header.
+type Header struct {
+	Protocol    meta.Protocol
+	Source      netip.AddrPort
+	Destination netip.AddrPort
+}
+
+// IsValid reports whether the header carries addresses, a header without
+// addresses is sent as UNKNOWN (v1) or LOCAL (v2).
+func (h Header) IsValid() bool {
+	return h.Source.IsValid() && h.Destination.IsValid() &&
+		(h.Protocol == meta.ProtocolTCP || h.Protocol == meta.ProtocolUDP)
+}
+
+// normalize makes both addresses of the same family, mapping IPv4 into IPv6 if needed.
+func (h Header) normalize() (source, destination netip.AddrPort, is4 bool) {
+	src, dst := h.Source.Addr().Unmap(), h.Destination.Addr().Unmap()
+	if src.Is4() && dst.Is4() {
+		return netip.AddrPortFrom(src, h.Source.Port()), netip.AddrPortFrom(dst, h.Destination.Port()), true
+	}
+	src = netip.AddrFrom16(src.As16())
+	dst = netip.AddrFrom16(dst.As16())
+	return netip.AddrPortFrom(src, h.Source.Port()), netip.AddrPortFrom(dst, h.Destination.Port()), false
+}
+
+// Append appends the encoded header in version to b.
+func (h Header) Append(b []byte, version Version) ([]byte, error) {
+	switch version {
+	case Version1:
+		return h.appendV1(b)
+	case Version2:
+		return h.appendV2(b), nil
+	default:
+		return nil, fmt.Errorf("proxyproto: unknown version: %d", version)
+	}
+}
+
+func (h Header) appendV1(b []byte) ([]byte, error) {
+	if !h.IsValid() {
+		return append(b, "PROXY UNKNOWN\r\n"...), nil
+	}
+	if h.Protocol != meta.ProtocolTCP {
+		return nil, fmt.Errorf("proxyproto: v1 does not support %s", h.Protocol)
+	}
+	src, dst, is4 := h.normalize()
+	family := "TCP6"
+	if is4 {
+		family = "TCP4"
+	}
+	b = append(b, "PROXY "+family+" "...)
+	b = append(b, src.Addr().String()+" "+dst.Addr().String()+" "...)
+	b = strconv.AppendUint(b, uint64(src.Port()), 10)
+	b = append(b, ' ')
+	b = strconv.AppendUint(b, uint64(dst.Port()), 10)
+	return append(b, "\r\n"...), nil
+}
+
+func (h Header) appendV2(b []byte) []byte {
+	b = append(b, v2Signature...)
+	if !h.IsValid() {
+		b = append(b, v2CommandLocal, v2FamilyUnspec)
+		return binary.BigEndian.AppendUint16(b, 0)
+	}
+	src, dst, is4 := h.normalize()
+	transport := byte(v2TransportStream)
+	if h.Protocol == meta.ProtocolUDP {
+		transport = v2TransportDgram
+	}
+	b = append(b, v2CommandProxy)
+	if is4 {
+		b = append(b, v2FamilyInet|transport)
+		b = binary.BigEndian.AppendUint16(b, 12)
+	} else {
+		b = append(b, v2FamilyInet6|transport)
+		b = binary.BigEndian.AppendUint16(b, 36)
+	}
+	b = append(b, src.Addr().AsSlice()...)
+	b = append(b, dst.Addr().AsSlice()...)
+	b = binary.BigEndian.AppendUint16(b, src.Port())
+	return binary.BigEndian.AppendUint16(b, dst.Port())
+}
@@ -0,0 +1,133 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/daminit/traffics-cli/infra/meta"
+)
+
+const v1MaxLength = 107
+
+var ErrNoHeader = errors.New("proxyproto: no header found")
+
+// ReadHeader reads a v1 or v2 header from r. A LOCAL or UNKNOWN header
+// returns an invalid Header without error.
+func ReadHeader(r *bufio.Reader) (Header, error) {
+	prefix, err := r.Peek(5)
+	if err != nil {
+		return Header{}, err
+	}
+	if string(prefix) == "PROXY" {
+		return readV1(r)
+	}
+	prefix, err = r.Peek(len(v2Signature))
+	if err != nil {
+		return Header{}, err
+	}
+	if bytes.Equal(prefix, v2Signature) {
+		return readV2(r)
+	}
+	return Header{}, ErrNoHeader
+}
+
+func readV1(r *bufio.Reader) (Header, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return Header{}, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return Header{}, errors.New("proxyproto: v1 header too long")
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return Header{}, nil
+	}
+	if len(fields) != 6 || fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return Header{}, fmt.Errorf("proxyproto: malformed v1 header: %q", line)
+	}
+	source, err := parseV1Address(fields[2], fields[4])
+	if err != nil {
+		return Header{}, err
+	}
+	destination, err := parseV1Address(fields[3], fields[5])
+	if err != nil {
+		return Header{}, err
+	}
+	return Header{Protocol: meta.ProtocolTCP, Source: source, Destination: destination}, nil
+}
+
+func parseV1Address(host, port string) (netip.AddrPort, error) {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("proxyproto: %w", err)
+	}
+	pp, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("proxyproto: %w", err)
+	}
+	return netip.AddrPortFrom(addr, uint16(pp)), nil
+}
+
+func readV2(r *bufio.Reader) (Header, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return Header{}, err
+	}
+	command, family := fixed[12], fixed[13]
+	length := int(binary.BigEndian.Uint16(fixed[14:]))
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Header{}, err
+	}
+	if command>>4 != 2 {
+		return Header{}, fmt.Errorf("proxyproto: unsupported v2 version: %d", command>>4)
+	}
+	if command == v2CommandLocal {
+		return Header{}, nil
+	}
+	if command != v2CommandProxy {
+		return Header{}, fmt.Errorf("proxyproto: unsupported v2 command: %d", command&0x0f)
+	}
+
+	var header Header
+	switch family & 0x0f {
+	case v2TransportStream:
+		header.Protocol = meta.ProtocolTCP
+	case v2TransportDgram:
+		header.Protocol = meta.ProtocolUDP
+	default:
+		return Header{}, nil
+	}
+	var size int
+	switch family & 0xf0 {
+	case v2FamilyInet:
+		size = 4
+	case v2FamilyInet6:
+		size = 16
+	default: // unspec and unix sockets carry no usable address
+		return Header{}, nil
+	}
+	if length < size*2+4 {
+		return Header{}, errors.New("proxyproto: v2 address block too short")
+	}
+	src, _ := netip.AddrFromSlice(payload[:size])
+	dst, _ := netip.AddrFromSlice(payload[size : size*2])
+	header.Source = netip.AddrPortFrom(src, binary.BigEndian.Uint16(payload[size*2:]))
+	header.Destination = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(payload[size*2+2:]))
+	return header, nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/netip"
+	"sync/atomic"
 	"time"
 
 	"github.com/daminit/traffics-cli/infra/meta"
@@ -23,6 +24,10 @@ type CachedResolver struct {
 	exchanger Exchanger
 	cache     *cache.LruCache[string, cacheResult]
 	ttl       int
+
+	// optional statistics
+	hits   *atomic.Int64
+	misses *atomic.Int64
 }
 
 func NewCachedResolverFromExchanger(client Exchanger, size int) *CachedResolver {
@@ -46,6 +51,11 @@ func NewCachedResolverFromResolver(client Resolver, size int, ttl int) *CachedRe
 	}
 }
 
+// SetStats makes the resolver count cache hits and misses into hits and misses.
+func (c *CachedResolver) SetStats(hits, misses *atomic.Int64) {
+	c.hits, c.misses = hits, misses
+}
+
 func (c *CachedResolver) Lookup(ctx context.Context, fqdn string, strategy meta.Strategy) (A []netip.Addr, AAAA []netip.Addr, err error) {
 	if fqdn == "" {
 		return nil, nil, errors.New("resolve: empty resolve fqdn")
@@ -55,8 +65,14 @@ func (c *CachedResolver) Lookup(ctx context.Context, fqdn string, strategy meta.
 	A, AAAA = FilterAddress(a, aaaa, strategy)
 
 	if len(A) != 0 || len(AAAA) != 0 {
+		if c.hits != nil {
+			c.hits.Add(1)
+		}
 		return A, AAAA, nil
 	}
+	if c.misses != nil {
+		c.misses.Add(1)
+	}
 	if c.exchanger != nil { // use exchanger to get more detailed info
 		A, AAAA, err = c.newExchange(ctx, fqdn, strategy)
 		if err != nil {
@@ -1,27 +1,133 @@
 package resolve
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/daminit/traffics-cli/infra/constant"
 	"github.com/daminit/traffics-cli/infra/meta"
+	"github.com/daminit/traffics-cli/infra/networks/tlsconf"
 	"github.com/miekg/dns"
 	"github.com/sagernet/sing/common/task"
 	"net"
+	"net/http"
 	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// NewClient returns the Exchanger of server: the address of a plain DNS
+// server, udp:// or tcp://host[:port] to pick its transport, tls://host[:port]
+// for DNS-over-TLS or https://host[:port][/path] for DNS-over-HTTPS. The
+// query of the URL may set the udp_size of udp, the sni, ca_file and
+// bootstrap address of tls and https, and the method of https.
+func NewClient(dialer net.Dialer, server string) (Exchanger, error) {
+	if !strings.Contains(server, "://") {
+		return NewRawClient(dialer, withPort(server, "53"), constant.DefaultDNSUDPSize), nil
+	}
+	uu, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+	if uu.Hostname() == "" {
+		return nil, fmt.Errorf("resolve: no host in %s", server)
+	}
+	var (
+		options   tlsconf.ClientOptions
+		bootstrap netip.Addr
+		post      bool
+		udpSize   uint16 = constant.DefaultDNSUDPSize
+		secure           = uu.Scheme == "tls" || uu.Scheme == "https"
+	)
+	for k, v := range uu.Query() {
+		val := v[len(v)-1]
+		switch {
+		case k == "sni" && secure:
+			options.ServerName = val
+		case k == "ca_file" && secure:
+			options.CAFile = val
+		case k == "bootstrap" && secure:
+			if bootstrap, err = netip.ParseAddr(val); err != nil {
+				return nil, fmt.Errorf("resolve: bootstrap: %w", err)
+			}
+		case k == "method" && uu.Scheme == "https":
+			switch strings.ToUpper(val) {
+			case http.MethodGet:
+				post = false
+			case http.MethodPost:
+				post = true
+			default:
+				return nil, fmt.Errorf("resolve: unsupported method: %s", val)
+			}
+		case k == "udp_size" && uu.Scheme == "udp":
+			size, err := strconv.ParseUint(val, 10, 16)
+			if err != nil || size < dns.MinMsgSize {
+				return nil, fmt.Errorf("resolve: udp_size must be between %d and %d, got %s", dns.MinMsgSize, dns.MaxMsgSize, val)
+			}
+			udpSize = uint16(size)
+		default:
+			return nil, fmt.Errorf("resolve: unknown option of %s: %s", uu.Redacted(), k)
+		}
+	}
+	switch uu.Scheme {
+	case "udp":
+		return NewRawClient(dialer, net.JoinHostPort(uu.Hostname(), cmp.Or(uu.Port(), "53")), udpSize), nil
+	case "tcp":
+		return NewTCPClient(dialer, net.JoinHostPort(uu.Hostname(), cmp.Or(uu.Port(), "53"))), nil
+	case "tls", "https":
+	default:
+		return nil, fmt.Errorf("resolve: unsupported dns server: %s", server)
+	}
+	config, err := tlsconf.NewClient(options)
+	if err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+	// the server name is the host even when the bootstrap address is dialed
+	config.ServerName = cmp.Or(config.ServerName, uu.Hostname())
+
+	if uu.Scheme == "tls" {
+		host := uu.Hostname()
+		if bootstrap.IsValid() {
+			host = bootstrap.String()
+		}
+		return NewTLSClient(dialer, net.JoinHostPort(host, cmp.Or(uu.Port(), "853")), config), nil
+	}
+	uu.RawQuery = ""
+	uu.Path = cmp.Or(uu.Path, "/dns-query")
+	return NewHTTPSClient(dialer, HTTPSOptions{
+		URL:       uu.String(),
+		TLS:       config,
+		Bootstrap: bootstrap,
+		Post:      post,
+	}), nil
+}
+
+// withPort adds port to address unless it has one already.
+func withPort(address, port string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(strings.Trim(address, "[]"), port)
+}
+
+// RawClient exchanges messages over UDP, advertising udpSize with EDNS0,
+// and retries truncated answers over TCP.
 type RawClient struct {
 	dialer      net.Dialer
 	destination string
+	udpSize     uint16
+	tcp         *StreamClient
 }
 
-func NewRawClient(dialer net.Dialer, destination string) *RawClient {
+func NewRawClient(dialer net.Dialer, destination string, udpSize uint16) *RawClient {
 	return &RawClient{
 		dialer:      dialer,
-		destination: net.JoinHostPort(destination, "53"),
+		destination: destination,
+		udpSize:     udpSize,
+		tcp:         NewTCPClient(dialer, destination),
 	}
 }
 
@@ -108,55 +214,38 @@ func (c *RawClient) Exchange(ctx context.Context, request *dns.Msg) (answer *dns
 	return c.exchange(ctx, request)
 }
 
+func (c *RawClient) Close() error {
+	return c.tcp.Close()
+}
+
 func (c *RawClient) exchange(ctx context.Context, request *dns.Msg) (answer *dns.Msg, err error) {
-	pack, err := request.Pack()
+	query := request
+	if request.IsEdns0() == nil {
+		query = request.Copy()
+		query.SetEdns0(c.udpSize, false)
+	}
+	pack, err := query.Pack()
 	if err != nil {
 		return nil, err
 	}
 
 	const maxRetries = 3
 	for retry := 0; retry < maxRetries; retry++ {
-		conn, err := c.dialer.DialContext(ctx, "udp", c.destination)
+		answer, err = c.exchangeUDP(ctx, pack)
 		if err != nil {
 			if retry == maxRetries-1 {
 				return nil, err
 			}
 			continue
 		}
-		defer conn.Close()
-
-		if deadline, ok := ctx.Deadline(); ok {
-			conn.SetDeadline(deadline)
-		} else {
-			conn.SetDeadline(time.Now().Add(constant.DefaultResolverReadTimeout))
-		}
-
-		if _, err := conn.Write(pack); err != nil {
-			if retry == maxRetries-1 {
-				return nil, err
-			}
-			continue
-		}
-
-		readBuf := make([]byte, 4096)
-		nn, err := conn.Read(readBuf)
-		if err != nil {
-			if retry == maxRetries-1 {
-				return nil, err
-			}
+		if answer.Id != request.Id {
 			continue
 		}
-
-		answer := new(dns.Msg)
-		if err := answer.Unpack(readBuf[:nn]); err != nil {
-			if retry == maxRetries-1 {
+		if answer.Truncated {
+			answer, err = c.tcp.Exchange(ctx, request)
+			if err != nil {
 				return nil, err
 			}
-			continue
-		}
-
-		if answer.Id != request.Id {
-			continue
 		}
 		if answer.Rcode != dns.RcodeSuccess {
 			return nil, RcodeError(answer.Rcode)
@@ -167,3 +256,35 @@ func (c *RawClient) exchange(ctx context.Context, request *dns.Msg) (answer *dns
 
 	return nil, errors.New("max retries exceeded")
 }
+
+// exchangeUDP sends pack in a datagram and reads the answer from a fresh
+// socket, so stale answers of previous attempts are never read.
+func (c *RawClient) exchangeUDP(ctx context.Context, pack []byte) (*dns.Msg, error) {
+	conn, err := c.dialer.DialContext(ctx, "udp", c.destination)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(constant.DefaultResolverReadTimeout))
+	}
+
+	if _, err := conn.Write(pack); err != nil {
+		return nil, err
+	}
+
+	readBuf := make([]byte, max(c.udpSize, dns.MinMsgSize))
+	nn, err := conn.Read(readBuf)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := new(dns.Msg)
+	if err := answer.Unpack(readBuf[:nn]); err != nil {
+		return nil, err
+	}
+	return answer, nil
+}
@@ -0,0 +1,169 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/daminit/traffics-cli/infra/constant"
+	"github.com/miekg/dns"
+)
+
+const (
+	GroupFailover   = "failover"
+	GroupRace       = "race"
+	GroupRoundRobin = "round_robin"
+)
+
+type GroupOptions struct {
+	Policy  string        // default: failover
+	Timeout time.Duration // of each query to a server, zero means the default
+}
+
+// Group exchanges messages with one of its servers picked by policy. A
+// server failing to answer is skipped for a while, unless every server
+// is failing.
+type Group struct {
+	servers []*groupServer
+	policy  string
+	timeout time.Duration
+	next    atomic.Uint64
+}
+
+type groupServer struct {
+	Exchanger
+	downUntil atomic.Int64 // unix nano
+}
+
+func NewGroup(exchangers []Exchanger, options GroupOptions) (*Group, error) {
+	if len(exchangers) == 0 {
+		return nil, errors.New("resolve: no dns server")
+	}
+	switch options.Policy {
+	case "":
+		options.Policy = GroupFailover
+	case GroupFailover, GroupRace, GroupRoundRobin:
+	default:
+		return nil, fmt.Errorf("resolve: unknown dns policy: %s", options.Policy)
+	}
+	if options.Timeout < 0 {
+		return nil, errors.New("resolve: dns timeout can not be negative")
+	}
+	g := &Group{
+		policy:  options.Policy,
+		timeout: options.Timeout,
+	}
+	if g.timeout == 0 {
+		g.timeout = constant.DefaultResolverReadTimeout
+	}
+	for _, exchanger := range exchangers {
+		g.servers = append(g.servers, &groupServer{Exchanger: exchanger})
+	}
+	return g, nil
+}
+
+func (g *Group) Exchange(ctx context.Context, request *dns.Msg) (*dns.Msg, error) {
+	servers := g.available()
+	if g.policy == GroupRace {
+		return g.race(ctx, servers, request)
+	}
+	if g.policy == GroupRoundRobin {
+		// the others follow in order as fallbacks
+		start := int((g.next.Add(1) - 1) % uint64(len(servers)))
+		servers = slices.Concat(servers[start:], servers[:start])
+	}
+	var errs []error
+	for _, server := range servers {
+		answer, err := g.exchange(ctx, server, request)
+		if err == nil || isFinal(err) {
+			return answer, err
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (g *Group) Close() error {
+	var errs []error
+	for _, server := range g.servers {
+		errs = append(errs, server.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// race sends request to every server and returns the first good answer.
+func (g *Group) race(ctx context.Context, servers []*groupServer, request *dns.Msg) (*dns.Msg, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		answer *dns.Msg
+		err    error
+	}
+	results := make(chan result, len(servers))
+	for _, server := range servers {
+		go func() {
+			// exchangers may rewrite the message
+			answer, err := g.exchange(ctx, server, request.Copy())
+			results <- result{answer, err}
+		}()
+	}
+	var errs []error
+	for range servers {
+		r := <-results
+		if r.err == nil || isFinal(r.err) {
+			return r.answer, r.err
+		}
+		errs = append(errs, r.err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (g *Group) exchange(ctx context.Context, server *groupServer, request *dns.Msg) (*dns.Msg, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	answer, err := server.Exchange(queryCtx, request)
+	if err == nil && (answer.Rcode == dns.RcodeServerFailure || answer.Rcode == dns.RcodeRefused) {
+		err = RcodeError(answer.Rcode)
+	}
+	var rcodeErr RcodeError
+	switch {
+	case err == nil:
+		server.downUntil.Store(0)
+	case errors.As(err, &rcodeErr):
+		// the server is up, it just has no good answer
+	case ctx.Err() == nil:
+		// not given up by the caller or a faster server
+		server.downUntil.Store(time.Now().Add(constant.DefaultDNSServerDownTime).UnixNano())
+	}
+	return answer, err
+}
+
+// available returns the servers not failing lately, or all of them when
+// every server is failing.
+func (g *Group) available() []*groupServer {
+	now := time.Now().UnixNano()
+	servers := make([]*groupServer, 0, len(g.servers))
+	for _, server := range g.servers {
+		if server.downUntil.Load() <= now {
+			servers = append(servers, server)
+		}
+	}
+	if len(servers) == 0 {
+		return append(servers, g.servers...)
+	}
+	return servers
+}
+
+// isFinal tells whether err is an answer no other server would change,
+// e.g. a name that does not exist.
+func isFinal(err error) bool {
+	var rcodeErr RcodeError
+	return errors.As(err, &rcodeErr) && rcodeErr != dns.RcodeServerFailure && rcodeErr != dns.RcodeRefused
+}
@@ -0,0 +1,181 @@
+package resolve
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/daminit/traffics-cli/infra/meta"
+	"github.com/miekg/dns"
+)
+
+type HostsOptions struct {
+	Hosts map[string][]netip.Addr
+	File  string // in /etc/hosts format
+}
+
+type hostsTable struct {
+	options HostsOptions
+	entries map[string][]netip.Addr // by lower case fqdn
+	modTime time.Time               // of the file
+}
+
+// Hosts is a static table of addresses by name, merged from the options
+// and the hosts file.
+type Hosts struct {
+	table atomic.Pointer[hostsTable]
+}
+
+func NewHosts(options HostsOptions) (*Hosts, error) {
+	table, err := loadHosts(options)
+	if err != nil {
+		return nil, err
+	}
+	h := &Hosts{}
+	h.table.Store(table)
+	return h, nil
+}
+
+// Lookup returns the addresses of fqdn, ok is false when it is not listed.
+func (h *Hosts) Lookup(fqdn string) (A []netip.Addr, AAAA []netip.Addr, ok bool) {
+	addresses, ok := h.table.Load().entries[strings.ToLower(dns.Fqdn(fqdn))]
+	for _, addr := range addresses {
+		if addr.Is4() {
+			A = append(A, addr)
+		} else {
+			AAAA = append(AAAA, addr)
+		}
+	}
+	return A, AAAA, ok
+}
+
+// Replace makes h serve the table of other, so the resolvers using h see
+// the changes of a reloaded configuration.
+func (h *Hosts) Replace(other *Hosts) {
+	h.table.Store(other.table.Load())
+}
+
+// Reload reads the hosts file again, the current table is kept on error.
+func (h *Hosts) Reload() error {
+	current := h.table.Load()
+	table, err := loadHosts(current.options)
+	if err != nil {
+		return err
+	}
+	// a table replaced meanwhile is newer
+	h.table.CompareAndSwap(current, table)
+	return nil
+}
+
+// Watch reloads the table whenever the hosts file changes until ctx is done.
+func (h *Hosts) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var (
+		failedTable   *hostsTable // the table kept by the last failed reload
+		failedModTime time.Time   // of the file it failed on
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		table := h.table.Load()
+		if table.options.File == "" {
+			continue
+		}
+		// zero for a missing file
+		var latest time.Time
+		if info, err := os.Stat(table.options.File); err == nil {
+			latest = info.ModTime()
+		}
+		if latest.Equal(table.modTime) || (table == failedTable && latest.Equal(failedModTime)) {
+			continue
+		}
+		if err := h.Reload(); err != nil {
+			failedTable, failedModTime = table, latest
+			onError(err)
+			continue
+		}
+		failedTable = nil
+	}
+}
+
+func loadHosts(options HostsOptions) (*hostsTable, error) {
+	table := &hostsTable{
+		options: options,
+		entries: make(map[string][]netip.Addr),
+	}
+	for name, addresses := range options.Hosts {
+		table.add(name, addresses...)
+	}
+	if options.File == "" {
+		return table, nil
+	}
+	f, err := os.Open(options.File)
+	if err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+	table.modTime = info.ModTime()
+
+	// address name [aliases...], '#' starts a comment
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		addr, err := netip.ParseAddr(fields[0])
+		if err != nil || len(fields) < 2 {
+			return nil, fmt.Errorf("resolve: %s:%d: expected an address and names", options.File, line)
+		}
+		for _, name := range fields[1:] {
+			table.add(name, addr)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+	return table, nil
+}
+
+func (t *hostsTable) add(name string, addresses ...netip.Addr) {
+	name = strings.ToLower(dns.Fqdn(name))
+	for _, addr := range addresses {
+		t.entries[name] = append(t.entries[name], addr.Unmap())
+	}
+}
+
+// HostsResolver answers the names listed in hosts and asks resolver for
+// the others.
+type HostsResolver struct {
+	hosts    *Hosts
+	resolver Resolver
+}
+
+func NewHostsResolver(hosts *Hosts, resolver Resolver) *HostsResolver {
+	return &HostsResolver{hosts: hosts, resolver: resolver}
+}
+
+func (r *HostsResolver) Lookup(ctx context.Context, fqdn string, strategy meta.Strategy) (A []netip.Addr, AAAA []netip.Addr, err error) {
+	if A, AAAA, ok := r.hosts.Lookup(fqdn); ok {
+		A, AAAA = FilterAddress(A, AAAA, strategy)
+		if len(A) != 0 || len(AAAA) != 0 {
+			return A, AAAA, nil
+		}
+		// no address of the wanted family, the resolver may have some
+	}
+	return r.resolver.Lookup(ctx, fqdn, strategy)
+}
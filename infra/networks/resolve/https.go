@@ -0,0 +1,156 @@
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daminit/traffics-cli/infra/constant"
+	"github.com/miekg/dns"
+)
+
+const dnsMessageType = "application/dns-message"
+
+// maxMessageSize bounds the body of a DNS-over-HTTPS response.
+const maxMessageSize = 65535
+
+type HTTPSOptions struct {
+	URL       string      // of the endpoint, e.g. https://dns.example/dns-query
+	TLS       *tls.Config // the server name defaults to the host of URL
+	Bootstrap netip.Addr  // dialed instead of resolving the host of URL
+	Post      bool        // send queries in the body instead of the dns parameter
+}
+
+// HTTPSClient exchanges messages with a DNS-over-HTTPS server (RFC 8484).
+// Connections are reused, with HTTP/2 when the server supports it.
+type HTTPSClient struct {
+	url    string
+	post   bool
+	client *http.Client
+}
+
+func NewHTTPSClient(dialer net.Dialer, options HTTPSOptions) *HTTPSClient {
+	transport := &http.Transport{
+		DialContext:       dialer.DialContext,
+		TLSClientConfig:   options.TLS,
+		ForceAttemptHTTP2: true,
+		IdleConnTimeout:   90 * time.Second,
+	}
+	if options.Bootstrap.IsValid() {
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			_, port, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, err
+			}
+			return dialer.DialContext(ctx, network, net.JoinHostPort(options.Bootstrap.String(), port))
+		}
+	}
+	return &HTTPSClient{
+		url:    options.URL,
+		post:   options.Post,
+		client: &http.Client{Transport: transport},
+	}
+}
+
+func (c *HTTPSClient) Exchange(ctx context.Context, request *dns.Msg) (*dns.Msg, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, constant.DefaultResolverReadTimeout)
+		defer cancel()
+	}
+	// a zero id makes the same queries cacheable by HTTP caches
+	query := request.Copy()
+	query.Id = 0
+	pack, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+
+	var httpRequest *http.Request
+	if c.post {
+		httpRequest, err = http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(pack))
+		if err == nil {
+			httpRequest.Header.Set("Content-Type", dnsMessageType)
+		}
+	} else {
+		httpRequest, err = http.NewRequestWithContext(ctx, http.MethodGet,
+			c.url+"?dns="+base64.RawURLEncoding.EncodeToString(pack), nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+	httpRequest.Header.Set("Accept", dnsMessageType)
+
+	response, err := c.client.Do(httpRequest)
+	if err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("resolve: %s: %s", c.url, response.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type")); mediaType != dnsMessageType {
+		return nil, fmt.Errorf("resolve: %s: unexpected content type %s", c.url, mediaType)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxMessageSize))
+	if err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+	answer := new(dns.Msg)
+	if err = answer.Unpack(body); err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+	answer.Id = request.Id
+	applyFreshness(answer, response.Header)
+	return answer, nil
+}
+
+// Close closes the idle connections, the ones of running queries are
+// closed once they are done.
+func (c *HTTPSClient) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// applyFreshness lowers the TTLs of answer to the HTTP freshness lifetime
+// of its response, minus the time it already spent in HTTP caches.
+func applyFreshness(answer *dns.Msg, header http.Header) {
+	maxAge, limited := -1, false
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			maxAge, limited = 0, true
+		case "max-age":
+			if seconds, err := strconv.Atoi(value); err == nil && !limited {
+				maxAge, limited = max(seconds, 0), true
+			}
+		}
+	}
+	age, _ := strconv.Atoi(header.Get("Age"))
+	if !limited && age <= 0 {
+		return
+	}
+	for _, records := range [][]dns.RR{answer.Answer, answer.Ns, answer.Extra} {
+		for _, rr := range records {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue // its ttl holds flags
+			}
+			ttl := int(rr.Header().Ttl)
+			if limited {
+				ttl = min(ttl, maxAge)
+			}
+			rr.Header().Ttl = uint32(max(ttl-max(age, 0), 0))
+		}
+	}
+}
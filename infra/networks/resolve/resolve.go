@@ -17,6 +17,8 @@ type Resolver interface {
 
 type Exchanger interface {
 	Exchange(ctx context.Context, msg *dns.Msg) (answer *dns.Msg, err error)
+	// Close releases the connections kept open to the servers.
+	Close() error
 }
 
 type DNSClient interface {
@@ -0,0 +1,250 @@
+package resolve
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/daminit/traffics-cli/infra/constant"
+	"github.com/miekg/dns"
+)
+
+var errConnClosed = errors.New("resolve: connection closed")
+
+// StreamClient exchanges messages with a DNS server over TCP, or over TLS
+// (RFC 7858). The queries are pipelined on one connection, which is dialed
+// again once the server closes it.
+type StreamClient struct {
+	dialer      net.Dialer
+	destination string
+	config      *tls.Config // nil for plain TCP
+
+	mu     sync.Mutex
+	conn   *pipelineConn
+	closed bool
+}
+
+func NewTCPClient(dialer net.Dialer, destination string) *StreamClient {
+	return &StreamClient{
+		dialer:      dialer,
+		destination: destination,
+	}
+}
+
+func NewTLSClient(dialer net.Dialer, destination string, config *tls.Config) *StreamClient {
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(destination)
+	}
+	return &StreamClient{
+		dialer:      dialer,
+		destination: destination,
+		config:      config,
+	}
+}
+
+func (c *StreamClient) Exchange(ctx context.Context, request *dns.Msg) (*dns.Msg, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, constant.DefaultResolverReadTimeout)
+		defer cancel()
+	}
+	// a reused connection may have been closed by the server meanwhile
+	for retry := 0; ; retry++ {
+		conn, reused, err := c.getConn(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("resolve: %w", err)
+		}
+		answer, err := conn.exchange(ctx, request)
+		if errors.Is(err, errConnClosed) && reused && retry == 0 {
+			continue
+		}
+		return answer, err
+	}
+}
+
+// getConn returns the open connection or dials a new one, reused tells
+// which one it is.
+func (c *StreamClient) getConn(ctx context.Context) (*pipelineConn, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, false, net.ErrClosed
+	}
+	if c.conn != nil && !c.conn.closed() {
+		return c.conn, true, nil
+	}
+	conn, err := c.dialer.DialContext(ctx, "tcp", c.destination)
+	if err != nil {
+		return nil, false, err
+	}
+	if c.config != nil {
+		tlsConn := tls.Client(conn, c.config)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, false, fmt.Errorf("tls handshake with %s: %w", c.destination, err)
+		}
+		conn = tlsConn
+	}
+	c.conn = newPipelineConn(conn)
+	return c.conn, false, nil
+}
+
+// Close closes the connection and its pending queries, the client is not
+// able to be used anymore.
+func (c *StreamClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if c.conn != nil {
+		c.conn.close(fmt.Errorf("resolve: %w", net.ErrClosed))
+	}
+	return nil
+}
+
+// pipelineConn sends queries over a stream without waiting for the
+// previous answers, which are matched to their queries by message id.
+type pipelineConn struct {
+	conn net.Conn
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[uint16]chan *dns.Msg
+	nextID  uint16
+	done    chan struct{}
+	err     error
+}
+
+func newPipelineConn(conn net.Conn) *pipelineConn {
+	c := &pipelineConn{
+		conn:    conn,
+		pending: make(map[uint16]chan *dns.Msg),
+		nextID:  dns.Id(),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *pipelineConn) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *pipelineConn) exchange(ctx context.Context, request *dns.Msg) (*dns.Msg, error) {
+	id, reply, err := c.register()
+	if err != nil {
+		return nil, err
+	}
+	defer c.unregister(id)
+
+	// the id is rewritten so concurrent queries never share one
+	query := request.Copy()
+	query.Id = id
+	pack, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+	if err = c.write(ctx, pack); err != nil {
+		return nil, err
+	}
+
+	select {
+	case answer := <-reply:
+		answer.Id = request.Id
+		return answer, nil
+	case <-c.done:
+		return nil, c.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// the connection may be dead without the server closing it
+			c.close(fmt.Errorf("%w: %w", errConnClosed, ctx.Err()))
+		}
+		return nil, fmt.Errorf("resolve: %w", ctx.Err())
+	}
+}
+
+func (c *pipelineConn) register() (uint16, chan *dns.Msg, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return 0, nil, c.err
+	}
+	for {
+		c.nextID++
+		if _, used := c.pending[c.nextID]; !used {
+			break
+		}
+	}
+	reply := make(chan *dns.Msg, 1)
+	c.pending[c.nextID] = reply
+	return c.nextID, reply, nil
+}
+
+func (c *pipelineConn) unregister(id uint16) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// write sends pack with its two bytes length prefix.
+func (c *pipelineConn) write(ctx context.Context, pack []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	deadline, _ := ctx.Deadline()
+	c.conn.SetWriteDeadline(deadline)
+	buffer := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(pack)), uint16(len(pack)))
+	if _, err := c.conn.Write(append(buffer, pack...)); err != nil {
+		c.close(fmt.Errorf("%w: %w", errConnClosed, err))
+		return c.err
+	}
+	return nil
+}
+
+func (c *pipelineConn) readLoop() {
+	var length [2]byte
+	for {
+		if _, err := io.ReadFull(c.conn, length[:]); err != nil {
+			c.close(fmt.Errorf("%w: %w", errConnClosed, err))
+			return
+		}
+		pack := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(c.conn, pack); err != nil {
+			c.close(fmt.Errorf("%w: %w", errConnClosed, err))
+			return
+		}
+		answer := new(dns.Msg)
+		if err := answer.Unpack(pack); err != nil {
+			continue // the query times out
+		}
+		c.mu.Lock()
+		reply, ok := c.pending[answer.Id]
+		c.mu.Unlock()
+		if ok {
+			select {
+			case reply <- answer:
+			default:
+			}
+		}
+	}
+}
+
+func (c *pipelineConn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.conn.Close()
+	close(c.done)
+}
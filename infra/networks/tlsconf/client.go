@@ -0,0 +1,48 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+type ClientOptions struct {
+	ServerName         string // empty means the host of the dialed server
+	CAFile             string // empty means the system roots
+	InsecureSkipVerify bool
+	ClientCert         string
+	ClientKey          string
+	ALPN               []string
+}
+
+// NewClient builds the TLS configuration used to dial servers.
+func NewClient(options ClientOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         options.ServerName,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+		NextProtos:         options.ALPN,
+	}
+	if options.CAFile != "" {
+		pem, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tlsconf: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tlsconf: no certificate found in %s", options.CAFile)
+		}
+	}
+	if options.ClientCert != "" || options.ClientKey != "" {
+		if options.ClientCert == "" || options.ClientKey == "" {
+			return nil, errors.New("tlsconf: client certificate requires both cert and key")
+		}
+		cert, err := tls.LoadX509KeyPair(options.ClientCert, options.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("tlsconf: load %s: %w", options.ClientCert, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,148 @@
+package tlsconf
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// KeyPair is a certificate file and its private key file, both PEM encoded.
+type KeyPair struct {
+	Cert string
+	Key  string
+}
+
+type ServerOptions struct {
+	Certificates []KeyPair // the first one is used when no SNI matches
+	MinVersion   uint16
+	ALPN         []string
+}
+
+// Server is the TLS configuration of a listener, its certificates are
+// chosen by SNI and able to be reloaded while serving.
+type Server struct {
+	options ServerOptions
+	config  *tls.Config
+	certs   atomic.Pointer[[]tls.Certificate]
+	modTime []time.Time // cert and key file of every pair
+}
+
+func NewServer(options ServerOptions) (*Server, error) {
+	if len(options.Certificates) == 0 {
+		return nil, errors.New("tlsconf: no certificate specified")
+	}
+	s := &Server{options: options}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	s.config = &tls.Config{
+		MinVersion:     options.MinVersion,
+		NextProtos:     options.ALPN,
+		GetCertificate: s.getCertificate,
+	}
+	return s, nil
+}
+
+func (s *Server) Config() *tls.Config {
+	return s.config
+}
+
+// Reload reads every certificate again, the current ones are kept on error.
+func (s *Server) Reload() error {
+	var (
+		certs   []tls.Certificate
+		modTime []time.Time
+	)
+	for _, pair := range s.options.Certificates {
+		for _, file := range []string{pair.Cert, pair.Key} {
+			info, err := os.Stat(file)
+			if err != nil {
+				return fmt.Errorf("tlsconf: %w", err)
+			}
+			modTime = append(modTime, info.ModTime())
+		}
+		cert, err := tls.LoadX509KeyPair(pair.Cert, pair.Key)
+		if err != nil {
+			return fmt.Errorf("tlsconf: load %s: %w", pair.Cert, err)
+		}
+		certs = append(certs, cert)
+	}
+	s.modTime = modTime
+	s.certs.Store(&certs)
+	return nil
+}
+
+// Watch reloads the certificates whenever a file changes until ctx is
+// done. A failed reload is reported once, until the files change again.
+func (s *Server) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var failed []time.Time // the files the last reload failed on
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		latest := s.stat()
+		if slices.EqualFunc(latest, s.modTime, time.Time.Equal) ||
+			(failed != nil && slices.EqualFunc(latest, failed, time.Time.Equal)) {
+			continue
+		}
+		if err := s.Reload(); err != nil {
+			failed = latest
+			onError(err)
+			continue
+		}
+		failed = nil
+	}
+}
+
+// stat returns the modification time of the cert and key file of every
+// pair, it is zero for a missing one.
+func (s *Server) stat() []time.Time {
+	var modTime []time.Time
+	for _, pair := range s.options.Certificates {
+		for _, file := range []string{pair.Cert, pair.Key} {
+			var mod time.Time
+			if info, err := os.Stat(file); err == nil {
+				mod = info.ModTime()
+			}
+			modTime = append(modTime, mod)
+		}
+	}
+	return modTime
+}
+
+func (s *Server) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := *s.certs.Load()
+	if hello.ServerName != "" {
+		for i := range certs {
+			if hello.SupportsCertificate(&certs[i]) == nil {
+				return &certs[i], nil
+			}
+		}
+	}
+	return &certs[0], nil
+}
+
+// ParseVersion parses a TLS version like "1.2", empty means TLS 1.2.
+func ParseVersion(s string) (uint16, error) {
+	switch s {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2", "":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("tlsconf: unknown tls version: %s", s)
+	}
+}
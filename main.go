@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/daminit/traffics-cli/infra/constant"
 	"golang.org/x/sys/unix"
 	"io"
 	"log/slog"
@@ -15,6 +16,8 @@ import (
 	"os/signal"
 	"runtime"
 	"runtime/debug"
+	"slices"
+	"time"
 )
 
 var (
@@ -24,6 +27,7 @@ var (
 	flagHelp   bool
 	flagPProf  bool
 	flagCheck  bool
+	flagWatch  bool
 
 	config Config
 )
@@ -35,6 +39,7 @@ Options:
 	-r [remote] : set a remote configuration
 	-c [config] : set the config file path
 	--check : check config only (dry-run)
+	--watch : reload when the config file changes
 	-h/--help : print help message
 
 Example:
@@ -98,15 +103,78 @@ func main() {
 		standardLogger.Error("start traffics failed", slog.String("error", err.Error()))
 		return
 	}
-	ch := make(chan os.Signal)
-	signal.Notify(ch, unix.SIGINT, os.Interrupt, unix.SIGSTOP, unix.SIGKILL, unix.SIGTERM)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, unix.SIGINT, os.Interrupt, unix.SIGSTOP, unix.SIGKILL, unix.SIGTERM, unix.SIGHUP)
 
-	<-ch
+	var (
+		watch   <-chan time.Time
+		modTime = configModTime()
+	)
+	if flagWatch && flagConfig != "" && flagConfig != "-" {
+		ticker := time.NewTicker(constant.DefaultConfigWatchInterval)
+		defer ticker.Stop()
+		watch = ticker.C
+	}
+
+	for {
+		select {
+		case sig := <-ch:
+			if sig == unix.SIGHUP {
+				reload(standardLogger, tf)
+				continue
+			}
+		case <-watch:
+			if latest := configModTime(); !latest.Equal(modTime) {
+				modTime = latest
+				reload(standardLogger, tf)
+			}
+			continue
+		}
+		break
+	}
 	cancel()
 	tf.Close()
 }
 
+func reload(logger *slog.Logger, tf *Traffics) {
+	if flagConfig == "-" {
+		logger.Warn("reload skipped: config was read from stdin")
+		return
+	}
+	newConfig, err := loadConfig()
+	if err != nil {
+		logger.Error("reload config failed, keep running the current one", slog.String("error", err.Error()))
+		return
+	}
+	if err = tf.Reload(newConfig); err != nil {
+		logger.Error("reload traffics failed", slog.String("error", err.Error()))
+		return
+	}
+	config = newConfig
+	logger.Info("config reloaded")
+}
+
+func configModTime() time.Time {
+	if flagConfig == "" || flagConfig == "-" {
+		return time.Time{}
+	}
+	info, err := os.Stat(flagConfig)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
 func initConfig() error {
+	internalConfig, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	config = internalConfig
+	return nil
+}
+
+func loadConfig() (Config, error) {
 	var internalConfig = NewConfig()
 
 	if flagConfig != "" {
@@ -121,37 +189,37 @@ func initConfig() error {
 		}
 
 		if err != nil {
-			return fmt.Errorf("read config file failed: %w", err)
+			return Config{}, fmt.Errorf("read config file failed: %w", err)
 		}
 
 		err = json.Unmarshal(bs, &internalConfig)
 		if err != nil {
-			return fmt.Errorf("parse config file failed: %w", err)
+			return Config{}, fmt.Errorf("parse config file failed: %w", err)
 		}
 	}
 
 	for _, k := range flagListen {
 		bind := NewDefaultBind()
 		if err := bind.Parse(k); err != nil {
-			return fmt.Errorf("parse '%s' failed: %w", k, err)
+			return Config{}, fmt.Errorf("parse '%s' failed: %w", k, err)
 		}
 		internalConfig.Binds = append(internalConfig.Binds, bind)
 	}
 	for _, k := range flagRemote {
 		remote := NewDefaultRemote()
 		if err := remote.Parse(k); err != nil {
-			return fmt.Errorf("parse '%s' failed: %w", k, err)
+			return Config{}, fmt.Errorf("parse '%s' failed: %w", k, err)
 		}
 		internalConfig.Remote = append(internalConfig.Remote, remote)
 	}
 
-	if len(internalConfig.Binds) == 0 || len(internalConfig.Remote) == 0 {
-		return errors.New("no available bind/remote found")
+	// socks5 binds can dial their destinations without remote
+	socksOnly := !slices.ContainsFunc(internalConfig.Binds, func(c BindConfig) bool { return c.Mode != bindModeSocks5 })
+	if len(internalConfig.Binds) == 0 || len(internalConfig.Remote) == 0 && !socksOnly {
+		return Config{}, errors.New("no available bind/remote found")
 	}
 
-	config = internalConfig
-
-	return nil
+	return internalConfig, nil
 }
 
 func parseFlags() error {
@@ -185,6 +253,9 @@ func parseFlags() error {
 		case "--check":
 			flagCheck = true
 			continue
+		case "--watch":
+			flagWatch = true
+			continue
 		default:
 			return fmt.Errorf("unknwon option %s", key)
 		}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/daminit/traffics-cli/infra/logging"
+	"github.com/daminit/traffics-cli/infra/meta"
+	"github.com/daminit/traffics-cli/infra/metrics"
+)
+
+const (
+	directionUpload   = "upload"   // client to remote
+	directionDownload = "download" // remote to client
+)
+
+type trafficMetrics struct {
+	registry *metrics.Registry
+
+	tcpAccepted    *metrics.Vec
+	tcpActive      *metrics.Vec
+	udpActive      *metrics.Vec
+	udpExpired     *metrics.Vec
+	bytes          *metrics.Vec
+	packets        *metrics.Vec
+	dialFailures   *metrics.Vec
+	rejected       *metrics.Vec
+	resolverHits   *metrics.Vec
+	resolverMisses *metrics.Vec
+}
+
+func newTrafficMetrics() *trafficMetrics {
+	r := metrics.NewRegistry()
+	return &trafficMetrics{
+		registry: r,
+		tcpAccepted: r.Counter("traffics_tcp_accepted_total",
+			"Accepted TCP connections.", "bind", "remote"),
+		tcpActive: r.Gauge("traffics_tcp_active",
+			"Active TCP relays.", "bind", "remote"),
+		udpActive: r.Gauge("traffics_udp_sessions_active",
+			"Active UDP sessions.", "bind", "remote"),
+		udpExpired: r.Counter("traffics_udp_sessions_expired_total",
+			"UDP sessions closed by udp_ttl.", "bind", "remote"),
+		bytes: r.Counter("traffics_bytes_total",
+			"Relayed bytes.", "bind", "remote", "network", "direction"),
+		packets: r.Counter("traffics_packets_total",
+			"Relayed UDP packets.", "bind", "remote", "direction"),
+		dialFailures: r.Counter("traffics_dial_failures_total",
+			"Failed dials to remotes.", "bind", "remote", "reason"),
+		rejected: r.Counter("traffics_rejected_total",
+			"Rejected TCP connections and UDP packets.", "bind", "network", "reason"),
+		resolverHits: r.Counter("traffics_resolver_cache_hits_total",
+			"Resolver cache hits.", "resolver"),
+		resolverMisses: r.Counter("traffics_resolver_cache_misses_total",
+			"Resolver cache misses.", "resolver"),
+	}
+}
+
+// serve starts the metrics server of config, the returned function stops it.
+func (m *trafficMetrics) serve(ctx context.Context, logger *slog.Logger, config MetricsConfig) (func(), error) {
+	if config.Listen == "" {
+		return func() {}, nil
+	}
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(cmp.Or(config.Path, "/metrics"), m.registry)
+	server := &http.Server{Handler: mux}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.ErrorContext(ctx, "metrics server stopped", logging.AttrError(err))
+		}
+	}()
+	logger.InfoContext(ctx, "metrics server started", slog.String("address", listener.Addr().String()))
+	return func() { server.Close() }, nil
+}
+
+// relayCounters are the metric values of one bind and remote pair,
+// values not relevant to the network are nil.
+type relayCounters struct {
+	Bind   string
+	Remote string
+
+	Accepted *atomic.Int64
+	Active   *atomic.Int64
+	Expired  *atomic.Int64
+
+	UploadBytes     *atomic.Int64
+	DownloadBytes   *atomic.Int64
+	UploadPackets   *atomic.Int64
+	DownloadPackets *atomic.Int64
+}
+
+func (m *trafficMetrics) relay(network meta.Protocol, bind, remote string) *relayCounters {
+	c := &relayCounters{
+		Bind:          bind,
+		Remote:        remote,
+		UploadBytes:   m.bytes.With(bind, remote, network.String(), directionUpload),
+		DownloadBytes: m.bytes.With(bind, remote, network.String(), directionDownload),
+	}
+	switch network {
+	case meta.ProtocolTCP:
+		c.Accepted = m.tcpAccepted.With(bind, remote)
+		c.Active = m.tcpActive.With(bind, remote)
+	case meta.ProtocolUDP:
+		c.Active = m.udpActive.With(bind, remote)
+		c.Expired = m.udpExpired.With(bind, remote)
+		c.UploadPackets = m.packets.With(bind, remote, directionUpload)
+		c.DownloadPackets = m.packets.With(bind, remote, directionDownload)
+	}
+	return c
+}
@@ -0,0 +1,128 @@
+package inbounds
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/daminit/traffics-cli/infra/meta"
+	"github.com/daminit/traffics-cli/infra/networks/limit"
+	M "github.com/sagernet/sing/common/metadata"
+)
+
+const (
+	RejectReasonACL            = "acl"
+	RejectReasonMaxConns       = "max_conns"
+	RejectReasonMaxConnsPerIP  = "max_conns_per_ip"
+	RejectReasonConnRate       = "conn_rate"
+	RejectReasonUDPSessionRate = "udp_session_rate"
+	RejectReasonSessionLimit   = "session_limit"
+	RejectReasonNoRoute        = "no_route"
+	RejectReasonAuth           = "auth"
+	RejectReasonDestination    = "destination"
+	RejectReasonUntrusted      = "untrusted"
+)
+
+// allowed checks source against the ACL of the inbound and records
+// the rejection if it is not allowed.
+func (o *Inbound) allowed(protocol meta.Protocol, source netip.AddrPort) bool {
+	if o.ACL == nil || o.ACL.Allowed(source.Addr()) {
+		return true
+	}
+	o.Reject(protocol, source, RejectReasonACL)
+	return false
+}
+
+// admit checks a new tcp connection against the ACL and the connection
+// limits, an admitted connection must be released once it is done. On a
+// PROXY protocol bind conn carries the source of its header, and its peer
+// has passed admitPeer already.
+func (o *Inbound) admit(conn net.Conn) bool {
+	source := M.AddrPortFromNet(conn.RemoteAddr())
+	if !o.allowed(meta.ProtocolTCP, source) {
+		return false
+	}
+	if o.connRate != nil && !o.connRate.Allow(source.Addr()) {
+		o.Reject(meta.ProtocolTCP, source, RejectReasonConnRate)
+		return false
+	}
+	if o.connLimiter != nil {
+		acquire := o.connLimiter.Acquire
+		if o.ProxyProtocol {
+			acquire = o.connLimiter.AcquireSource
+		}
+		if err := acquire(source.Addr()); err != nil {
+			reason := RejectReasonMaxConns
+			if errors.Is(err, limit.ErrMaxConnsPerIP) {
+				reason = RejectReasonMaxConnsPerIP
+			}
+			o.Reject(meta.ProtocolTCP, source, reason)
+			return false
+		}
+	}
+	return true
+}
+
+// admitPeer checks the peer of a new tcp connection of a PROXY protocol
+// bind against the trusted peers and max_conns, before it may send the
+// header. An admitted peer must be released with releasePeer unless its
+// connection is admitted later.
+func (o *Inbound) admitPeer(conn net.Conn) bool {
+	peer := M.AddrPortFromNet(conn.RemoteAddr())
+	if len(o.ProxyProtocolTrusted) != 0 && !o.ProxyProtocolTrusted.Contains(peer.Addr()) {
+		o.Reject(meta.ProtocolTCP, peer, RejectReasonUntrusted)
+		return false
+	}
+	if o.connLimiter != nil {
+		if err := o.connLimiter.AcquireTotal(); err != nil {
+			o.Reject(meta.ProtocolTCP, peer, RejectReasonMaxConns)
+			return false
+		}
+	}
+	return true
+}
+
+func (o *Inbound) releasePeer() {
+	if o.connLimiter != nil {
+		o.connLimiter.ReleaseTotal()
+	}
+}
+
+func (o *Inbound) release(conn net.Conn) {
+	if o.connLimiter != nil {
+		o.connLimiter.Release(M.AddrPortFromNet(conn.RemoteAddr()).Addr())
+	}
+}
+
+// AdmitSession reports whether source may create a new udp session.
+func (o *Inbound) AdmitSession(source netip.AddrPort) bool {
+	if o.udpSessionRate != nil && !o.udpSessionRate.Allow(source.Addr()) {
+		o.Reject(meta.ProtocolUDP, source, RejectReasonUDPSessionRate)
+		return false
+	}
+	return true
+}
+
+// Reject counts a rejected connection or packet and logs it, at most once
+// per RejectLogInterval.
+func (o *Inbound) Reject(protocol meta.Protocol, source netip.AddrPort, reason string) {
+	if o.OnReject != nil {
+		o.OnReject(protocol, source, reason)
+	}
+
+	suppressed := o.rejectSuppressed.Add(1)
+	now := time.Now().UnixNano()
+	last := o.rejectLogged.Load()
+	if now-last < int64(o.RejectLogInterval) || !o.rejectLogged.CompareAndSwap(last, now) {
+		return
+	}
+	o.rejectSuppressed.Add(-suppressed)
+	o.Logger.WarnContext(o.ctx, "source rejected",
+		slog.String("network", protocol.String()),
+		slog.String("source", source.String()),
+		slog.String("reason", reason),
+		slog.Int64("count", suppressed),
+	)
+}
@@ -3,24 +3,60 @@ package inbounds
 import (
 	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/netip"
+	"os"
+	"sync/atomic"
+	"time"
 
 	"github.com/daminit/traffics-cli/infra/constant"
 	"github.com/daminit/traffics-cli/infra/logging"
 	"github.com/daminit/traffics-cli/infra/meta"
+	"github.com/daminit/traffics-cli/infra/networks/acl"
+	"github.com/daminit/traffics-cli/infra/networks/limit"
 	"github.com/daminit/traffics-cli/infra/networks/listener"
+	"github.com/daminit/traffics-cli/infra/networks/tlsconf"
+	"github.com/daminit/traffics-cli/proxy/route"
+	"github.com/daminit/traffics-cli/proxy/socks"
 	"github.com/sagernet/sing/common"
+	M "github.com/sagernet/sing/common/metadata"
 )
 
 type PacketWriter interface {
 	WritePacket(bs []byte, remote netip.AddrPort)
 }
 
+// Peer is the client of a datagram, a udp address or the socket name of a
+// unixgram client, which has no address.
+type Peer struct {
+	Addr netip.AddrPort
+	Name string
+}
+
+// CanReply reports whether replies are able to reach the peer, which is
+// not the case for unbound unixgram clients.
+func (p Peer) CanReply() bool {
+	return p.Addr.IsValid() || p.Name != ""
+}
+
+func (p Peer) String() string {
+	switch {
+	case p.Name != "":
+		return p.Name
+	case p.Addr.IsValid():
+		return p.Addr.String()
+	default:
+		return "unbound"
+	}
+}
+
 type PacketHandler interface {
-	HandlePacket(p []byte, remote netip.AddrPort, pw PacketWriter)
+	// HandlePacket handles a datagram of peer sent to local, local is
+	// invalid when unknown.
+	HandlePacket(p []byte, peer Peer, local netip.AddrPort, pw PacketWriter)
 }
 
 type ConnHandler interface {
@@ -28,12 +64,12 @@ type ConnHandler interface {
 }
 
 type (
-	FuncPacketHandler func(p []byte, remote netip.AddrPort, pw PacketWriter)
+	FuncPacketHandler func(p []byte, peer Peer, local netip.AddrPort, pw PacketWriter)
 	FuncConnHandler   func(ctx context.Context, conn net.Conn)
 )
 
-func (f FuncPacketHandler) HandlePacket(p []byte, remote netip.AddrPort, pw PacketWriter) {
-	f(p, remote, pw)
+func (f FuncPacketHandler) HandlePacket(p []byte, peer Peer, local netip.AddrPort, pw PacketWriter) {
+	f(p, peer, local, pw)
 }
 func (f FuncConnHandler) HandleConn(ctx context.Context, conn net.Conn) {
 	f(ctx, conn)
@@ -41,6 +77,7 @@ func (f FuncConnHandler) HandleConn(ctx context.Context, conn net.Conn) {
 
 type Inbound struct {
 	ctx      context.Context
+	Name     string
 	Logger   *slog.Logger
 	Listener *listener.Listener
 
@@ -50,19 +87,72 @@ type Inbound struct {
 	Port          uint16
 	UDPBufferSize int
 
+	// PROXY protocol, tcp only
+	ProxyProtocol        bool
+	ProxyProtocolTrusted meta.PrefixList // empty means trust every peer
+	ProxyProtocolTimeout time.Duration
+
+	// TLS termination, tcp and unix only
+	TLS *tlsconf.Server
+	// Router picks the remote of every tcp and unix connection, the
+	// ConnHandler finds it with route.RemoteFromContext.
+	Router *route.Router
+	// Socks serves a SOCKS5 handshake on every tcp connection instead, the
+	// ConnHandler finds the request with socks.RequestFromContext.
+	Socks *socks.Server
+
+	// access control
+	ACL               *acl.ACL
+	RejectLogInterval time.Duration
+	OnReject          func(protocol meta.Protocol, source netip.AddrPort, reason string)
+
+	// limits, zero means unlimited
+	MaxConns       int
+	MaxConnsPerIP  int
+	ConnRate       float64 // new tcp connections per second per source
+	UDPSessionRate float64 // new udp sessions per second per source
+
 	// Handler
 	PacketHandler PacketHandler
 	ConnHandler   ConnHandler
 
 	// internal
-	udpConn     *net.UDPConn
-	tcpListener net.Listener
-	cancel      context.CancelFunc
+	udpConn      *net.UDPConn
+	udpPktInfo   bool // udpConn reports the local address of datagrams
+	unixgramConn *net.UnixConn
+	tcpListener  net.Listener // tcp or unix
+	cancel       context.CancelFunc
+
+	rejectLogged     atomic.Int64 // unix nano
+	rejectSuppressed atomic.Int64
+	connLimiter      *limit.ConnLimiter
+	connRate         *limit.RateLimiter
+	udpSessionRate   *limit.RateLimiter
 }
 
 func (o *Inbound) Start(ctx context.Context) error {
 	o.ctx, o.cancel = context.WithCancel(ctx)
 
+	if o.MaxConns > 0 || o.MaxConnsPerIP > 0 {
+		o.connLimiter = limit.NewConnLimiter(o.MaxConns, o.MaxConnsPerIP)
+	}
+	if o.ConnRate > 0 {
+		o.connRate = limit.NewRateLimiter(o.ConnRate, constant.DefaultRateLimiterSize)
+	}
+	if o.UDPSessionRate > 0 {
+		o.udpSessionRate = limit.NewRateLimiter(o.UDPSessionRate, constant.DefaultRateLimiterSize)
+	}
+	if o.ACL != nil {
+		go o.ACL.Watch(o.ctx, constant.DefaultACLWatchInterval, func(err error) {
+			o.Logger.ErrorContext(o.ctx, "reload acl failed", logging.AttrError(err))
+		})
+	}
+	if o.TLS != nil {
+		go o.TLS.Watch(o.ctx, constant.DefaultCertWatchInterval, func(err error) {
+			o.Logger.ErrorContext(o.ctx, "reload tls certificates failed", logging.AttrError(err))
+		})
+	}
+
 	var err error
 	if o.Protocols.Contains(string(meta.ProtocolTCP)) {
 		if o.ConnHandler == nil {
@@ -84,19 +174,51 @@ func (o *Inbound) Start(ctx context.Context) error {
 		if err != nil {
 			return fmt.Errorf("inbounds: %w", err)
 		}
+		if o.UDPAddr().Addr().IsUnspecified() {
+			// the local address of a datagram is only known per packet
+			o.udpPktInfo = listener.EnablePacketInfo(o.udpConn) == nil
+		}
 
 		go o.loopUdpIn()
 		o.Logger.InfoContext(o.ctx, "new udp server started",
 			slog.String("address", o.udpConn.LocalAddr().String()))
 	}
+	if o.Protocols.ContainsProtocol(meta.ProtocolUnix) {
+		if o.ConnHandler == nil {
+			return fmt.Errorf("inbounds: ConnHandler required")
+		}
+		o.tcpListener, err = o.Listener.ListenUnix(o.ctx, o.Address)
+		if err != nil {
+			return fmt.Errorf("inbounds: %w", err)
+		}
+		o.Logger.InfoContext(o.ctx, "new unix server started",
+			slog.String("address", o.Address))
+		go o.loopTcp()
+	}
+	if o.Protocols.ContainsProtocol(meta.ProtocolUnixgram) {
+		if o.PacketHandler == nil {
+			return fmt.Errorf("inbounds: PacketHandler required")
+		}
+		o.unixgramConn, err = o.Listener.ListenUnixgram(o.ctx, o.Address)
+		if err != nil {
+			return fmt.Errorf("inbounds: %w", err)
+		}
+		go o.loopUnixgramIn()
+		o.Logger.InfoContext(o.ctx, "new unixgram server started",
+			slog.String("address", o.Address))
+	}
 	return nil
 }
 
 func (o *Inbound) loopUdpIn() {
 	bufferSize := cmp.Or(o.UDPBufferSize, constant.DefaultUDPReadBufferSize)
 	buf := make([]byte, bufferSize)
+	var oob []byte
+	if o.udpPktInfo {
+		oob = make([]byte, 128)
+	}
 	for {
-		n, remote, err := o.udpConn.ReadFromUDPAddrPort(buf[0:bufferSize])
+		n, oobn, _, remote, err := o.udpConn.ReadMsgUDPAddrPort(buf[0:bufferSize], oob)
 		if err == nil && n == 0 {
 			panic("seems like the udp buffer size is zero: see https://github.com/golang/go/issues/23849")
 		}
@@ -111,7 +233,10 @@ func (o *Inbound) loopUdpIn() {
 			o.Logger.ErrorContext(o.ctx, "invalid address")
 			continue
 		}
-		o.PacketHandler.HandlePacket(buf[:n], remote, o)
+		if !o.allowed(meta.ProtocolUDP, remote) {
+			continue
+		}
+		o.PacketHandler.HandlePacket(buf[:n], Peer{Addr: remote}, o.packetDestination(oob[:oobn]), o)
 	}
 }
 
@@ -122,6 +247,27 @@ func (o *Inbound) WritePacket(bs []byte, remote netip.AddrPort) {
 	}
 }
 
+// packetDestination returns the local address a datagram with the control
+// messages oob was sent to, it is invalid when unknown.
+func (o *Inbound) packetDestination(oob []byte) netip.AddrPort {
+	local := o.UDPAddr()
+	if !local.Addr().IsUnspecified() {
+		return local
+	}
+	if addr := listener.PacketDestination(oob); addr.IsValid() {
+		return netip.AddrPortFrom(addr, local.Port())
+	}
+	return netip.AddrPort{}
+}
+
+// UDPAddr returns the local address of the udp listener.
+func (o *Inbound) UDPAddr() netip.AddrPort {
+	if o.udpConn == nil {
+		return netip.AddrPort{}
+	}
+	return o.udpConn.LocalAddr().(*net.UDPAddr).AddrPort()
+}
+
 func (o *Inbound) loopTcp() {
 	for {
 		conn, err := o.tcpListener.Accept()
@@ -133,10 +279,85 @@ func (o *Inbound) loopTcp() {
 				logging.AttrError(err))
 			continue
 		}
-		go o.ConnHandler.HandleConn(o.ctx, conn)
+		admit := o.admit
+		if o.ProxyProtocol {
+			// the real source is only known after the header, until then
+			// the peer holds one of max_conns
+			admit = o.admitPeer
+		}
+		if !admit(conn) {
+			conn.Close()
+			continue
+		}
+		go o.handleConn(conn)
 	}
 }
 
+func (o *Inbound) handleConn(conn net.Conn) {
+	if o.ProxyProtocol {
+		proxied, err := o.acceptProxyProtocol(conn)
+		if err != nil {
+			o.releasePeer()
+			o.Logger.WarnContext(o.ctx, "read proxy protocol header failed",
+				slog.String("source", conn.RemoteAddr().String()), logging.AttrError(err))
+			conn.Close()
+			return
+		}
+		conn = proxied
+		if !o.admit(conn) {
+			o.releasePeer()
+			conn.Close()
+			return
+		}
+	}
+	defer o.release(conn)
+	if o.TLS != nil {
+		tlsConn, err := o.handshake(conn)
+		if err != nil {
+			o.Logger.WarnContext(o.ctx, "tls handshake failed",
+				slog.String("source", conn.RemoteAddr().String()), logging.AttrError(err))
+			conn.Close()
+			return
+		}
+		conn = tlsConn
+	}
+	ctx := o.ctx
+	if o.Router != nil {
+		routed, remote, err := o.Router.Route(conn)
+		if err != nil {
+			o.Logger.DebugContext(o.ctx, "read route failed",
+				slog.String("source", conn.RemoteAddr().String()), logging.AttrError(err))
+			conn.Close()
+			return
+		}
+		if remote == "" {
+			o.Reject(meta.ProtocolTCP, M.AddrPortFromNet(conn.RemoteAddr()), RejectReasonNoRoute)
+			routed.Close()
+			return
+		}
+		conn, ctx = routed, route.ContextWithRemote(ctx, remote)
+	}
+	if o.Socks != nil {
+		request, err := o.Socks.Handshake(conn)
+		if err != nil {
+			source := M.AddrPortFromNet(conn.RemoteAddr())
+			switch {
+			case errors.Is(err, socks.ErrAuth):
+				o.Reject(meta.ProtocolTCP, source, RejectReasonAuth)
+			case errors.Is(err, socks.ErrNotAllowed):
+				o.Reject(meta.ProtocolTCP, source, RejectReasonDestination)
+			default:
+				o.Logger.DebugContext(o.ctx, "socks handshake failed",
+					slog.String("source", source.String()), logging.AttrError(err))
+			}
+			conn.Close()
+			return
+		}
+		ctx = socks.ContextWithRequest(ctx, request)
+	}
+	o.ConnHandler.HandleConn(ctx, conn)
+}
+
 func (o *Inbound) Close() error {
 	o.cancel()
 	if o.tcpListener != nil {
@@ -145,5 +366,11 @@ func (o *Inbound) Close() error {
 	if o.udpConn != nil {
 		o.udpConn.Close()
 	}
+	if o.unixgramConn != nil {
+		o.unixgramConn.Close()
+		if !listener.IsAbstract(o.Address) {
+			os.Remove(o.Address)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,35 @@
+package inbounds
+
+import (
+	"bufio"
+	"net"
+	"time"
+
+	"github.com/daminit/traffics-cli/infra/networks/proxyproto"
+	"github.com/sagernet/sing/common/buf"
+	sbufio "github.com/sagernet/sing/common/bufio"
+)
+
+// acceptProxyProtocol strips the PROXY protocol header of conn and returns
+// a connection reporting the conveyed addresses, the peer is checked by
+// admitPeer.
+func (o *Inbound) acceptProxyProtocol(conn net.Conn) (net.Conn, error) {
+	conn.SetReadDeadline(time.Now().Add(o.ProxyProtocolTimeout))
+	reader := bufio.NewReader(conn)
+	header, err := proxyproto.ReadHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	// replay what has been read ahead of the header
+	if n := reader.Buffered(); n > 0 {
+		cached := buf.NewSize(n)
+		cached.ReadFullFrom(reader, n)
+		conn = sbufio.NewCachedConn(conn, cached)
+	}
+	if !header.IsValid() {
+		return conn, nil
+	}
+	return proxyproto.NewConn(conn, header), nil
+}
@@ -0,0 +1,20 @@
+package inbounds
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/daminit/traffics-cli/infra/constant"
+)
+
+// handshake terminates TLS on conn.
+func (o *Inbound) handshake(conn net.Conn) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(o.ctx, constant.DefaultTLSHandshakeTimeout)
+	defer cancel()
+	tlsConn := tls.Server(conn, o.TLS.Config())
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,49 @@
+package inbounds
+
+import (
+	"cmp"
+	"log/slog"
+	"net"
+	"net/netip"
+
+	"github.com/daminit/traffics-cli/infra/constant"
+	"github.com/daminit/traffics-cli/infra/logging"
+	"github.com/sagernet/sing/common"
+)
+
+// unixgramPeer writes replies back to the unix datagram socket of a client.
+type unixgramPeer struct {
+	inbound *Inbound
+	addr    *net.UnixAddr
+}
+
+func (p *unixgramPeer) WritePacket(bs []byte, _ netip.AddrPort) {
+	if p.addr == nil || p.addr.Name == "" {
+		// an unbound client is unable to receive anything
+		return
+	}
+	_, err := p.inbound.unixgramConn.WriteToUnix(bs, p.addr)
+	if err != nil {
+		p.inbound.Logger.ErrorContext(p.inbound.ctx, "write unixgram message", logging.AttrError(err))
+	}
+}
+
+func (o *Inbound) loopUnixgramIn() {
+	bufferSize := cmp.Or(o.UDPBufferSize, constant.DefaultUDPReadBufferSize)
+	buf := make([]byte, bufferSize)
+	for {
+		n, addr, err := o.unixgramConn.ReadFromUnix(buf)
+		if err != nil {
+			if common.Done(o.ctx) {
+				return
+			}
+			o.Logger.ErrorContext(o.ctx, "read unixgram message", slog.String("error", err.Error()))
+			continue
+		}
+		var peer Peer
+		if addr != nil {
+			peer.Name = addr.Name
+		}
+		o.PacketHandler.HandlePacket(buf[:n], peer, netip.AddrPort{}, &unixgramPeer{inbound: o, addr: addr})
+	}
+}
@@ -0,0 +1,91 @@
+package outbounds
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"sync/atomic"
+
+	"github.com/daminit/traffics-cli/infra/meta"
+)
+
+const (
+	BalanceRoundRobin     = "round_robin"
+	BalanceWeightedRandom = "weighted_random"
+	BalanceLeastConn      = "least_conn"
+	BalanceSourceHash     = "source_hash"
+)
+
+type Balancer interface {
+	// Pick chooses one of servers, servers is never empty.
+	Pick(ctx context.Context, servers []*Server) *Server
+}
+
+func NewBalancer(policy string) (Balancer, error) {
+	switch policy {
+	case BalanceRoundRobin, "":
+		return &roundRobinBalancer{}, nil
+	case BalanceWeightedRandom:
+		return weightedRandomBalancer{}, nil
+	case BalanceLeastConn:
+		return leastConnBalancer{}, nil
+	case BalanceSourceHash:
+		return sourceHashBalancer{}, nil
+	default:
+		return nil, fmt.Errorf("outbounds: unknown balance policy: %s", policy)
+	}
+}
+
+type roundRobinBalancer struct {
+	next atomic.Uint64
+}
+
+func (b *roundRobinBalancer) Pick(_ context.Context, servers []*Server) *Server {
+	return servers[(b.next.Add(1)-1)%uint64(len(servers))]
+}
+
+type weightedRandomBalancer struct{}
+
+func (weightedRandomBalancer) Pick(_ context.Context, servers []*Server) *Server {
+	total := 0
+	for _, s := range servers {
+		total += s.Weight
+	}
+	if total <= 0 {
+		return servers[rand.IntN(len(servers))]
+	}
+	n := rand.IntN(total)
+	for _, s := range servers {
+		n -= s.Weight
+		if n < 0 {
+			return s
+		}
+	}
+	return servers[len(servers)-1]
+}
+
+type leastConnBalancer struct{}
+
+func (leastConnBalancer) Pick(_ context.Context, servers []*Server) *Server {
+	// compare active/weight without division: a/wa < b/wb <=> a*wb < b*wa
+	best := servers[0]
+	for _, s := range servers[1:] {
+		if s.Active()*int64(best.Weight) < best.Active()*int64(s.Weight) {
+			best = s
+		}
+	}
+	return best
+}
+
+type sourceHashBalancer struct{}
+
+func (sourceHashBalancer) Pick(ctx context.Context, servers []*Server) *Server {
+	metadata, ok := meta.MetadataFromContext(ctx)
+	if !ok || !metadata.Source.IsValid() {
+		return servers[rand.IntN(len(servers))]
+	}
+	h := fnv.New32a()
+	h.Write(metadata.Source.Addr().Unmap().AsSlice())
+	return servers[h.Sum32()%uint32(len(servers))]
+}
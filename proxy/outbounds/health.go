@@ -0,0 +1,131 @@
+package outbounds
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/daminit/traffics-cli/infra/logging"
+)
+
+const (
+	HealthCheckTCP = "tcp"
+	HealthCheckUDP = "udp"
+	HealthCheckTLS = "tls"
+)
+
+type HealthCheck struct {
+	Type     string
+	Interval time.Duration
+	Timeout  time.Duration
+	// Rise is the number of consecutive successful checks to mark
+	// an unhealthy server healthy again, Fall is the opposite.
+	Rise int
+	Fall int
+
+	// udp only
+	Send   []byte
+	Expect []byte
+}
+
+func (h *HealthCheck) Valid() error {
+	switch h.Type {
+	case HealthCheckTCP, HealthCheckTLS:
+	case HealthCheckUDP:
+		if len(h.Send) == 0 {
+			return errors.New("health check: udp check requires a payload to send")
+		}
+	default:
+		return fmt.Errorf("health check: unknown type: %s", h.Type)
+	}
+	if h.Interval <= 0 || h.Timeout <= 0 {
+		return errors.New("health check: interval and timeout must greater than 0")
+	}
+	if h.Rise <= 0 || h.Fall <= 0 {
+		return errors.New("health check: rise and fall must greater than 0")
+	}
+	return nil
+}
+
+func (o *Outbound) healthLoop(ctx context.Context, server *Server) {
+	ticker := time.NewTicker(o.HealthCheck.Interval)
+	defer ticker.Stop()
+
+	var rise, fall int
+	for {
+		err := o.check(ctx, server)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			rise, fall = rise+1, 0
+			if server.unhealthy.Load() && rise >= o.HealthCheck.Rise {
+				server.unhealthy.Store(false)
+				o.Logger.InfoContext(ctx, "server is healthy again",
+					slog.String("server", server.Address))
+			}
+		} else {
+			rise, fall = 0, fall+1
+			if !server.unhealthy.Load() && fall >= o.HealthCheck.Fall {
+				server.unhealthy.Store(true)
+				o.Logger.WarnContext(ctx, "server is unhealthy",
+					slog.String("server", server.Address), logging.AttrError(err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *Outbound) check(ctx context.Context, server *Server) error {
+	ctx, cancel := context.WithTimeout(ctx, o.HealthCheck.Timeout)
+	defer cancel()
+
+	network := HealthCheckTCP
+	if o.HealthCheck.Type == HealthCheckUDP {
+		network = HealthCheckUDP
+	}
+	// the port offsets of binds are not applied, a server of a port range
+	// remote is probed on the first port of its range only.
+	conn, err := o.Dialer.DialContext(ctx, o.dialNetwork(network), server.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	switch o.HealthCheck.Type {
+	case HealthCheckTLS:
+		host, _, _ := net.SplitHostPort(server.Address)
+		// a completed handshake is all we need, the certificate
+		// is not verified.
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: true,
+		})
+		return tlsConn.HandshakeContext(ctx)
+	case HealthCheckUDP:
+		if _, err = conn.Write(o.HealthCheck.Send); err != nil {
+			return err
+		}
+		buffer := make([]byte, 2048)
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return err
+		}
+		if len(o.HealthCheck.Expect) != 0 && !bytes.Contains(buffer[:n], o.HealthCheck.Expect) {
+			return errors.New("unexpected response")
+		}
+	}
+	return nil
+}
@@ -2,20 +2,239 @@ package outbounds
 
 import (
 	"context"
-	"github.com/daminit/traffics-cli/infra/networks/dialer"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/daminit/traffics-cli/infra/constant"
+	"github.com/daminit/traffics-cli/infra/meta"
+	"github.com/daminit/traffics-cli/infra/networks/dialer"
+	"github.com/daminit/traffics-cli/infra/networks/proxyproto"
+	N "github.com/sagernet/sing/common/network"
 )
 
-type Outbound struct {
-	Logger  *slog.Logger
-	Dialer  dialer.Dialer
+type Server struct {
 	Address string
+	Weight  int
+
+	active    atomic.Int64
+	unhealthy atomic.Bool
+}
+
+func (s *Server) Healthy() bool {
+	return !s.unhealthy.Load()
+}
+
+// Active returns the number of connections currently opened to this server.
+func (s *Server) Active() int64 {
+	return s.active.Load()
+}
+
+type Outbound struct {
+	Name     string
+	Logger   *slog.Logger
+	Dialer   dialer.Dialer
+	Servers  []*Server
+	Balancer Balancer
+
+	// optional
+	HealthCheck   *HealthCheck
+	Backup        *Outbound          // used when no server is healthy
+	ProxyProtocol proxyproto.Version // zero means disabled
+	Network       meta.Protocol      // unix or unixgram, empty dials the network of the client
+	TLS           *tls.Config        // originate TLS to the servers, stream only
+	DNS           io.Closer          // the dns client of Dialer, closed with the outbound
+
+	// internal
+	cancel context.CancelFunc
+}
+
+// Start runs the health checks until ctx is done or Close is called.
+func (o *Outbound) Start(ctx context.Context) {
+	ctx, o.cancel = context.WithCancel(ctx)
+	if o.HealthCheck == nil {
+		return
+	}
+	for _, server := range o.Servers {
+		go o.healthLoop(ctx, server)
+	}
+}
+
+func (o *Outbound) Close() error {
+	if o.cancel != nil {
+		o.cancel()
+	}
+	if o.DNS != nil {
+		return o.DNS.Close()
+	}
+	return nil
 }
 
 func (o *Outbound) DialContext(ctx context.Context, network string) (net.Conn, error) {
+	if len(o.Servers) == 0 {
+		return nil, errors.New("outbounds: no server available")
+	}
+	servers := o.healthyServers()
+	if len(servers) == 0 {
+		if o.Backup != nil {
+			o.Logger.WarnContext(ctx, "no healthy server, fallback to backup")
+			return o.Backup.DialContext(ctx, network)
+		}
+		servers = o.Servers // try anyway
+	}
+	server := servers[0]
+	if len(servers) > 1 {
+		server = o.Balancer.Pick(ctx, servers)
+	}
+	address := server.Address
+	if metadata, _ := meta.MetadataFromContext(ctx); metadata.PortOffsets[o.Name] != 0 {
+		var err error
+		address, err = shiftPort(address, metadata.PortOffsets[o.Name])
+		if err != nil {
+			return nil, err
+		}
+	}
+	o.Logger.InfoContext(ctx, "new connection",
+		slog.String("network", network),
+		slog.String("server", address),
+	)
+	conn, err := o.Dialer.DialContext(ctx, o.dialNetwork(network), address)
+	if err != nil {
+		return nil, err
+	}
+	if o.ProxyProtocol != 0 {
+		conn, err = o.proxyProtocol(ctx, network, conn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.TLS != nil {
+		conn, err = o.handshake(ctx, conn, address)
+		if err != nil {
+			return nil, err
+		}
+	}
+	server.active.Add(1)
+	return &serverConn{Conn: conn, server: server}, nil
+}
+
+// DialAddress dials address with the dialer of this outbound instead of
+// its servers, for binds whose clients pick the destination.
+func (o *Outbound) DialAddress(ctx context.Context, network, address string) (net.Conn, error) {
 	o.Logger.InfoContext(ctx, "new connection",
 		slog.String("network", network),
+		slog.String("destination", address),
 	)
-	return o.Dialer.DialContext(ctx, network, o.Address)
+	return o.Dialer.DialContext(ctx, network, address)
+}
+
+// proxyProtocol conveys the client address of ctx to the server, a stream
+// gets a header once while every datagram of a packet connection gets one.
+func (o *Outbound) proxyProtocol(ctx context.Context, network string, conn net.Conn) (net.Conn, error) {
+	nn, _ := meta.ParseNetwork(network)
+	metadata, _ := meta.MetadataFromContext(ctx)
+	header := proxyproto.Header{
+		Protocol:    nn.Protocol,
+		Source:      metadata.Source,
+		Destination: metadata.Destination,
+	}
+	if nn.Protocol == meta.ProtocolUDP {
+		return proxyproto.NewPacketConn(conn, header), nil
+	}
+	if err := proxyproto.WriteHeader(conn, o.ProxyProtocol, header); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("outbounds: write proxy protocol header: %w", err)
+	}
+	return conn, nil
+}
+
+// handshake starts TLS on conn, the server name defaults to the host of address.
+func (o *Outbound) handshake(ctx context.Context, conn net.Conn, address string) (net.Conn, error) {
+	config := o.TLS
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(address)
+	}
+	ctx, cancel := context.WithTimeout(ctx, constant.DefaultTLSHandshakeTimeout)
+	defer cancel()
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w with %s: %w", dialer.ErrTLSHandshake, address, err)
+	}
+	return tlsConn, nil
+}
+
+func (o *Outbound) dialNetwork(network string) string {
+	if o.Network != "" {
+		return o.Network.String()
+	}
+	return network
+}
+
+// shiftPort adds offset to the port of address.
+func shiftPort(address string, offset uint16) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("outbounds: %w", err)
+	}
+	pp, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("outbounds: %w", err)
+	}
+	if pp += uint64(offset); pp > math.MaxUint16 {
+		return "", fmt.Errorf("outbounds: port of %s out of range with offset %d", address, offset)
+	}
+	return net.JoinHostPort(host, strconv.FormatUint(pp, 10)), nil
+}
+
+func (o *Outbound) healthyServers() []*Server {
+	if o.HealthCheck == nil {
+		return o.Servers
+	}
+	servers := make([]*Server, 0, len(o.Servers))
+	for _, s := range o.Servers {
+		if s.Healthy() {
+			servers = append(servers, s)
+		}
+	}
+	return servers
+}
+
+type serverConn struct {
+	net.Conn
+	server *Server
+	once   sync.Once
+}
+
+func (c *serverConn) Close() error {
+	c.once.Do(func() {
+		c.server.active.Add(-1)
+	})
+	return c.Conn.Close()
+}
+
+// CloseWrite half-closes the connection underneath, so the server still
+// gets to answer a client done writing.
+func (c *serverConn) CloseWrite() error {
+	return N.CloseWrite(c.Conn)
+}
+
+func (c *serverConn) Upstream() any {
+	return c.Conn
+}
+
+func (c *serverConn) ReaderReplaceable() bool {
+	return true
+}
+
+func (c *serverConn) WriterReplaceable() bool {
+	return true
 }
@@ -0,0 +1,59 @@
+package route
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+var errHeaderTooLarge = errors.New("route: request header too large")
+
+// readRequest parses the head of the HTTP/1.x request read from r and
+// returns its host, without port, and path.
+func readRequest(r io.Reader, limit int) (host, path string, err error) {
+	limited := &io.LimitedReader{R: r, N: int64(limit)}
+	req, err := http.ReadRequest(bufio.NewReader(limited))
+	if err != nil {
+		if limited.N <= 0 {
+			return "", "", errHeaderTooLarge
+		}
+		return "", "", err
+	}
+	host = req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host, req.URL.Path, nil
+}
+
+// httpStatus returns the response to a request that can not be routed.
+func httpStatus(err error, knownHost bool) int {
+	switch {
+	case errors.Is(err, errHeaderTooLarge):
+		return http.StatusRequestHeaderFieldsTooLarge
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return http.StatusRequestTimeout
+	case err != nil:
+		return http.StatusBadRequest
+	case knownHost:
+		return http.StatusNotFound
+	default:
+		return http.StatusMisdirectedRequest
+	}
+}
+
+// writeStatus writes a plain text response with status to conn.
+func writeStatus(conn net.Conn, status int, timeout time.Duration) error {
+	text := strconv.Itoa(status) + " " + http.StatusText(status)
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	defer conn.SetWriteDeadline(time.Time{})
+	_, err := fmt.Fprintf(conn, "HTTP/1.1 %s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s\n",
+		text, len(text)+1, text)
+	return err
+}
@@ -0,0 +1,127 @@
+package route
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/sagernet/sing/common/buf"
+	sbufio "github.com/sagernet/sing/common/bufio"
+)
+
+// maxPeekSize bounds the bytes buffered while looking for a route.
+const maxPeekSize = 64 * 1024
+
+// recordTypeHandshake is the first byte of a TLS ClientHello.
+const recordTypeHandshake = 0x16
+
+// Options of a Router, a connection goes to the first remote found by
+// the rules of its protocol, Protocols and then Default.
+type Options struct {
+	Default    string              // remote of connections matching no rule, empty rejects them
+	Protocols  map[Protocol]string // by the protocol sniffed from the first bytes
+	SNI        HostRules           // by the server name of the TLS ClientHello
+	HTTP       HTTPRules           // by the host and path of the first HTTP/1.x request
+	HeaderSize int                 // limit of the HTTP request head
+	Timeout    time.Duration
+}
+
+// Router picks the remote of a connection from its first bytes, which are
+// replayed to the remote afterwards.
+type Router struct {
+	options Options
+	http    httpRoutes
+}
+
+func New(options Options) *Router {
+	r := &Router{options: options}
+	if len(options.HTTP) != 0 {
+		r.http = compileHTTPRules(options.HTTP)
+	}
+	return r
+}
+
+// Route returns the remote of conn and a connection replaying what has been
+// read from conn. An empty remote means no route, an HTTP client has been
+// answered with an error status then. An error means conn is not usable
+// anymore.
+func (r *Router) Route(conn net.Conn) (net.Conn, string, error) {
+	peeked := &bytes.Buffer{}
+	reader := io.TeeReader(io.LimitReader(conn, int64(max(maxPeekSize, r.options.HeaderSize))), peeked)
+
+	conn.SetReadDeadline(time.Now().Add(r.options.Timeout))
+	protocol, remote, status, err := r.match(reader)
+	conn.SetReadDeadline(time.Time{})
+
+	if peeked.Len() > 0 {
+		conn = sbufio.NewCachedConn(conn, buf.As(peeked.Bytes()))
+	}
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded) && peeked.Len() == 0:
+		// the client waits for the server to speak first
+		return conn, cmp.Or(r.options.Protocols[ProtocolTimeout], r.options.Default), nil
+	case err != nil && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed)):
+		return nil, "", err
+	}
+	if remote = cmp.Or(remote, r.options.Protocols[protocol], r.options.Default); remote != "" {
+		return conn, remote, nil
+	}
+	if status != 0 {
+		if err := writeStatus(conn, status, r.options.Timeout); err != nil {
+			return nil, "", err
+		}
+	}
+	return conn, "", nil
+}
+
+// match sniffs the protocol of the connection read by reader and returns
+// the remote its rules pick, or the HTTP status answering it when it is an
+// HTTP request without route.
+func (r *Router) match(reader io.Reader) (Protocol, string, int, error) {
+	protocol, head, err := sniff(reader)
+	if err != nil {
+		return protocol, "", 0, err
+	}
+	reader = io.MultiReader(bytes.NewReader(head), reader)
+
+	switch {
+	case protocol == ProtocolTLS && len(r.options.SNI) != 0:
+		serverName, err := readServerName(reader)
+		if err != nil {
+			return protocol, "", 0, err
+		}
+		remote, _ := r.options.SNI.Match(serverName)
+		return protocol, remote, 0, nil
+	case protocol == ProtocolHTTP && r.http != nil:
+		host, path, err := readRequest(reader, r.options.HeaderSize)
+		if err != nil {
+			return protocol, "", httpStatus(err, false), err
+		}
+		remote, knownHost := r.http.Match(host, path)
+		if remote == "" {
+			return protocol, "", httpStatus(nil, knownHost), nil
+		}
+		return protocol, remote, 0, nil
+	default:
+		return protocol, "", 0, nil
+	}
+}
+
+type remoteKey struct{}
+
+// ContextWithRemote records the remote picked for a connection.
+func ContextWithRemote(ctx context.Context, remote string) context.Context {
+	return context.WithValue(ctx, remoteKey{}, remote)
+}
+
+// RemoteFromContext returns the remote picked for a connection, empty if
+// no router is involved.
+func RemoteFromContext(ctx context.Context) string {
+	remote, _ := ctx.Value(remoteKey{}).(string)
+	return remote
+}
@@ -0,0 +1,112 @@
+package route
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// HostRules maps host names to remotes. A pattern is an exact name or a
+// "*.suffix" wildcard, an exact name wins over wildcards and a longer
+// suffix over a shorter one.
+type HostRules map[string]string
+
+// Match returns the remote of host.
+func (r HostRules) Match(host string) (string, bool) {
+	return matchHost(r, host)
+}
+
+func matchHost[V any](rules map[string]V, host string) (V, bool) {
+	var zero V
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return zero, false
+	}
+	if v, ok := rules[host]; ok {
+		return v, true
+	}
+	for suffix := host; ; {
+		_, rest, found := strings.Cut(suffix, ".")
+		if !found {
+			return zero, false
+		}
+		if v, ok := rules["*."+rest]; ok {
+			return v, true
+		}
+		suffix = rest
+	}
+}
+
+// ValidPattern checks a host pattern of HostRules.
+func ValidPattern(pattern string) error {
+	name := strings.TrimPrefix(pattern, "*.")
+	if name == "" || strings.Contains(name, "*") || name != strings.ToLower(name) {
+		return fmt.Errorf("invalid host pattern: %s", pattern)
+	}
+	return nil
+}
+
+// HTTPRules maps "host" or "host/path/prefix" patterns to remotes. The host
+// is matched like HostRules, then the longest prefix of the path, which
+// matches whole segments only: "/api" matches "/api" and "/api/v1" but
+// not "/apix".
+type HTTPRules map[string]string
+
+// ValidHTTPPattern checks a pattern of HTTPRules.
+func ValidHTTPPattern(pattern string) error {
+	host, _ := splitHTTPPattern(pattern)
+	return ValidPattern(host)
+}
+
+func splitHTTPPattern(pattern string) (host, prefix string) {
+	if i := strings.IndexByte(pattern, '/'); i >= 0 {
+		return pattern[:i], pattern[i:]
+	}
+	return pattern, "/"
+}
+
+type pathRule struct {
+	prefix string
+	remote string
+}
+
+// httpRoutes is HTTPRules grouped by host, the rules of a host are sorted
+// from the longest prefix to the shortest.
+type httpRoutes map[string][]pathRule
+
+func compileHTTPRules(rules HTTPRules) httpRoutes {
+	routes := make(httpRoutes)
+	for pattern, remote := range rules {
+		host, prefix := splitHTTPPattern(pattern)
+		routes[host] = append(routes[host], pathRule{prefix: prefix, remote: remote})
+	}
+	for _, paths := range routes {
+		slices.SortFunc(paths, func(a, b pathRule) int {
+			return cmp.Compare(len(b.prefix), len(a.prefix))
+		})
+	}
+	return routes
+}
+
+// Match returns the remote of a request, knownHost reports whether any
+// rule exists for host.
+func (r httpRoutes) Match(host, path string) (remote string, knownHost bool) {
+	paths, ok := matchHost(r, host)
+	if !ok {
+		return "", false
+	}
+	for _, rule := range paths {
+		if hasPathPrefix(path, rule.prefix) {
+			return rule.remote, true
+		}
+	}
+	return "", true
+}
+
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
@@ -0,0 +1,87 @@
+package route
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Protocol is what the first bytes of a connection look like.
+type Protocol string
+
+const (
+	ProtocolSSH  Protocol = "ssh"
+	ProtocolTLS  Protocol = "tls"
+	ProtocolHTTP Protocol = "http"
+	// ProtocolTimeout is a client sending nothing before the route
+	// timeout, it probably waits for the server to speak first.
+	ProtocolTimeout Protocol = "timeout"
+
+	protocolUnknown Protocol = ""
+)
+
+// ValidProtocol checks a protocol name of Options.Protocols.
+func ValidProtocol(name string) error {
+	switch Protocol(name) {
+	case ProtocolSSH, ProtocolTLS, ProtocolHTTP, ProtocolTimeout:
+		return nil
+	default:
+		return fmt.Errorf("unknown protocol: %s", name)
+	}
+}
+
+// maxMethodSize bounds the HTTP method, the longest registered one is
+// UPDATEREDIRECTREF.
+const maxMethodSize = 20
+
+var sshPrefix = []byte("SSH-")
+
+// sniff reads the first bytes of a connection until they tell its protocol,
+// a client stopping halfway is an unknown protocol. The bytes read are
+// returned as well.
+func sniff(r io.Reader) (Protocol, []byte, error) {
+	var (
+		head = make([]byte, maxMethodSize+1)
+		n    int
+	)
+	for {
+		m, err := r.Read(head[n:])
+		n += m
+		if protocol, ok := classify(head[:n]); ok {
+			return protocol, head[:n], nil
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) && n > 0 {
+			return protocolUnknown, head[:n], nil
+		}
+		if err != nil {
+			return protocolUnknown, head[:n], err
+		}
+	}
+}
+
+// classify tells the protocol of head, ok is false if more bytes are
+// needed.
+func classify(head []byte) (protocol Protocol, ok bool) {
+	switch {
+	case len(head) == 0:
+		return protocolUnknown, false
+	case head[0] == recordTypeHandshake:
+		return ProtocolTLS, true
+	case bytes.HasPrefix(head, sshPrefix):
+		return ProtocolSSH, true
+	case bytes.HasPrefix(sshPrefix, head):
+		return protocolUnknown, false
+	}
+	// an HTTP request line starts with an upper case method and a space
+	for i, c := range head {
+		switch {
+		case c == ' ' && i > 0:
+			return ProtocolHTTP, true
+		case (c < 'A' || c > 'Z') && c != '-', i >= maxMethodSize:
+			return protocolUnknown, true
+		}
+	}
+	return protocolUnknown, false
+}
@@ -0,0 +1,43 @@
+package route
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+var errHelloRead = errors.New("route: client hello read")
+
+// readServerName parses the TLS ClientHello read from r and returns the
+// server name it asks for.
+func readServerName(r io.Reader) (string, error) {
+	var serverName string
+	var parsed bool
+	err := tls.Server(readOnlyConn{r}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName, parsed = hello.ServerName, true
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	if !parsed {
+		return "", err
+	}
+	return serverName, nil
+}
+
+// readOnlyConn feeds a reader to crypto/tls, which never writes before
+// the ClientHello is parsed.
+type readOnlyConn struct {
+	r io.Reader
+}
+
+func (c readOnlyConn) Read(p []byte) (int, error)       { return c.r.Read(p) }
+func (c readOnlyConn) Write([]byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (c readOnlyConn) Close() error                     { return nil }
+func (c readOnlyConn) LocalAddr() net.Addr              { return nil }
+func (c readOnlyConn) RemoteAddr() net.Addr             { return nil }
+func (c readOnlyConn) SetDeadline(time.Time) error      { return nil }
+func (c readOnlyConn) SetReadDeadline(time.Time) error  { return nil }
+func (c readOnlyConn) SetWriteDeadline(time.Time) error { return nil }
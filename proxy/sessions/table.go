@@ -0,0 +1,165 @@
+package sessions
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrTableFull = errors.New("sessions: table is full")
+
+type OverflowPolicy uint8
+
+const (
+	OverflowEvictOldest OverflowPolicy = iota // "evict"
+	OverflowDrop                              // "drop"
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowEvictOldest:
+		return "evict"
+	case OverflowDrop:
+		return "drop"
+	default:
+		return fmt.Sprintf("overflow: %d", uint8(p))
+	}
+}
+
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch s {
+	case "evict", "":
+		return OverflowEvictOldest, nil
+	case "drop":
+		return OverflowDrop, nil
+	default:
+		return 0, fmt.Errorf("sessions: unknown overflow policy: %s", s)
+	}
+}
+
+type EvictCallback[K comparable, V comparable] func(key K, value V)
+
+type Options[K comparable, V comparable] struct {
+	// MaxSize is the maximum number of sessions, zero means unlimited.
+	MaxSize  int
+	Overflow OverflowPolicy
+	// OnEvict is called (outside the table lock) for every session
+	// removed by the LRU policy or by Close.
+	OnEvict EvictCallback[K, V]
+}
+
+type entry[K comparable, V comparable] struct {
+	key   K
+	value V
+}
+
+// Table is a concurrency-safe session table with a bounded size and a
+// least-recently-used eviction order.
+type Table[K comparable, V comparable] struct {
+	mu      sync.Mutex
+	options Options[K, V]
+	lru     *list.List
+	items   map[K]*list.Element
+	closed  bool
+}
+
+func NewTable[K comparable, V comparable](options Options[K, V]) *Table[K, V] {
+	return &Table[K, V]{
+		options: options,
+		lru:     list.New(),
+		items:   make(map[K]*list.Element),
+	}
+}
+
+// Load returns the session of key and marks it as recently used.
+func (t *Table[K, V]) Load(key K) (value V, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	le, ok := t.items[key]
+	if !ok {
+		return value, false
+	}
+	t.lru.MoveToFront(le)
+	return le.Value.(*entry[K, V]).value, true
+}
+
+// Store adds a new session. If the table is full, the least recently used
+// session is evicted or ErrTableFull is returned depending on the overflow policy.
+func (t *Table[K, V]) Store(key K, value V) error {
+	var evicted []*entry[K, V]
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return errors.New("sessions: table closed")
+	}
+	if le, ok := t.items[key]; ok {
+		evicted = append(evicted, le.Value.(*entry[K, V]))
+		t.lru.Remove(le)
+		delete(t.items, key)
+	}
+	if t.options.MaxSize > 0 && t.lru.Len() >= t.options.MaxSize {
+		if t.options.Overflow == OverflowDrop {
+			t.mu.Unlock()
+			t.evict(evicted)
+			return ErrTableFull
+		}
+		for t.lru.Len() >= t.options.MaxSize {
+			oldest := t.lru.Back()
+			old := oldest.Value.(*entry[K, V])
+			t.lru.Remove(oldest)
+			delete(t.items, old.key)
+			evicted = append(evicted, old)
+		}
+	}
+	t.items[key] = t.lru.PushFront(&entry[K, V]{key: key, value: value})
+	t.mu.Unlock()
+
+	t.evict(evicted)
+	return nil
+}
+
+// CompareAndDelete deletes the session of key only if it still holds value,
+// so a finished session never removes the one that replaced it.
+func (t *Table[K, V]) CompareAndDelete(key K, value V) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	le, ok := t.items[key]
+	if !ok || le.Value.(*entry[K, V]).value != value {
+		return false
+	}
+	t.lru.Remove(le)
+	delete(t.items, key)
+	return true
+}
+
+func (t *Table[K, V]) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lru.Len()
+}
+
+// Close evicts every session and rejects further stores.
+func (t *Table[K, V]) Close() {
+	t.mu.Lock()
+	t.closed = true
+	evicted := make([]*entry[K, V], 0, t.lru.Len())
+	for le := t.lru.Front(); le != nil; le = le.Next() {
+		evicted = append(evicted, le.Value.(*entry[K, V]))
+	}
+	t.lru.Init()
+	clear(t.items)
+	t.mu.Unlock()
+
+	t.evict(evicted)
+}
+
+func (t *Table[K, V]) evict(entries []*entry[K, V]) {
+	if t.options.OnEvict == nil {
+		return
+	}
+	for _, e := range entries {
+		t.options.OnEvict(e.key, e.value)
+	}
+}
@@ -0,0 +1,98 @@
+package socks
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/daminit/traffics-cli/proxy/route"
+	M "github.com/sagernet/sing/common/metadata"
+)
+
+// Allowlist is the destinations clients may reach. An address has to be
+// in one of the prefixes and a domain name has to match one of the domain
+// patterns, names are not resolved to be checked against the prefixes.
+type Allowlist struct {
+	prefixes []netip.Prefix
+	domains  route.HostRules // pattern => pattern
+	ports    []portRange     // empty allows every port
+}
+
+type portRange struct {
+	start, end uint16
+}
+
+// ParseAllowlist parses destinations, CIDRs, addresses, domain names or
+// "*.suffix" patterns, and ports like "80,443,8000-9000". No destination
+// allows every destination.
+func ParseAllowlist(destinations []string, ports []string) (*Allowlist, error) {
+	a := &Allowlist{}
+	for _, d := range destinations {
+		if prefix, err := netip.ParsePrefix(d); err == nil {
+			a.prefixes = append(a.prefixes, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(d); err == nil {
+			a.prefixes = append(a.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		pattern := strings.ToLower(d)
+		if err := route.ValidPattern(pattern); err != nil {
+			return nil, fmt.Errorf("socks: invalid destination: %s", d)
+		}
+		if a.domains == nil {
+			a.domains = make(route.HostRules)
+		}
+		a.domains[pattern] = pattern
+	}
+	for _, p := range ports {
+		first, last, isRange := strings.Cut(p, "-")
+		start, err := strconv.ParseUint(first, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("socks: invalid port: %s", p)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.ParseUint(last, 10, 16); err != nil || end < start {
+				return nil, fmt.Errorf("socks: invalid port range: %s", p)
+			}
+		}
+		a.ports = append(a.ports, portRange{start: uint16(start), end: uint16(end)})
+	}
+	return a, nil
+}
+
+// Allowed reports whether destination may be reached, a nil Allowlist
+// allows everything.
+func (a *Allowlist) Allowed(destination M.Socksaddr) bool {
+	if a == nil {
+		return true
+	}
+	if len(a.ports) != 0 && !a.allowedPort(destination.Port) {
+		return false
+	}
+	if len(a.prefixes) == 0 && len(a.domains) == 0 {
+		return true
+	}
+	if destination.IsFqdn() {
+		_, ok := a.domains.Match(destination.Fqdn)
+		return ok
+	}
+	addr := destination.Addr.Unmap()
+	for _, prefix := range a.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Allowlist) allowedPort(port uint16) bool {
+	for _, r := range a.ports {
+		if port >= r.start && port <= r.end {
+			return true
+		}
+	}
+	return false
+}
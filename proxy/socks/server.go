@@ -0,0 +1,129 @@
+package socks
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	M "github.com/sagernet/sing/common/metadata"
+	"github.com/sagernet/sing/common/varbin"
+	"github.com/sagernet/sing/protocol/socks/socks5"
+)
+
+var (
+	ErrAuth        = errors.New("socks: authentication failed")
+	ErrNotAllowed  = errors.New("socks: destination not allowed")
+	ErrUnsupported = errors.New("socks: command not supported")
+)
+
+// Server is the SOCKS5 handshake of a bind, it serves CONNECT and UDP
+// ASSOCIATE requests.
+type Server struct {
+	Users   map[string]string // username => password, empty means no authentication
+	Allow   *Allowlist        // nil allows every destination
+	Timeout time.Duration     // of the handshake
+}
+
+type Request struct {
+	Command     byte // socks5.CommandConnect or socks5.CommandUDPAssociate
+	Destination M.Socksaddr
+}
+
+// Handshake authenticates the client of conn and reads its request, a
+// request which is refused has been answered when an error is returned.
+func (s *Server) Handshake(conn net.Conn) (Request, error) {
+	conn.SetDeadline(time.Now().Add(s.Timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	reader := varbin.StubReader(conn)
+	authRequest, err := socks5.ReadAuthRequest(reader)
+	if err != nil {
+		return Request{}, fmt.Errorf("socks: %w", err)
+	}
+	if err = s.authenticate(conn, reader, authRequest.Methods); err != nil {
+		return Request{}, err
+	}
+
+	request, err := socks5.ReadRequest(reader)
+	if err != nil {
+		return Request{}, fmt.Errorf("socks: %w", err)
+	}
+	switch request.Command {
+	case socks5.CommandConnect:
+		if !s.Allow.Allowed(request.Destination) {
+			Reply(conn, socks5.ReplyCodeNotAllowed, M.Socksaddr{})
+			return Request{}, fmt.Errorf("%w: %s", ErrNotAllowed, request.Destination)
+		}
+	case socks5.CommandUDPAssociate:
+		// destinations are checked per datagram
+	default:
+		Reply(conn, socks5.ReplyCodeUnsupported, M.Socksaddr{})
+		return Request{}, fmt.Errorf("%w: %d", ErrUnsupported, request.Command)
+	}
+	return Request{Command: request.Command, Destination: request.Destination}, nil
+}
+
+func (s *Server) authenticate(conn net.Conn, reader varbin.Reader, methods []byte) error {
+	method := socks5.AuthTypeNotRequired
+	if len(s.Users) != 0 {
+		method = socks5.AuthTypeUsernamePassword
+	}
+	if !slices.Contains(methods, method) {
+		socks5.WriteAuthResponse(conn, socks5.AuthResponse{Method: socks5.AuthTypeNoAcceptedMethods})
+		return fmt.Errorf("%w: no accepted method", ErrAuth)
+	}
+	if err := socks5.WriteAuthResponse(conn, socks5.AuthResponse{Method: method}); err != nil {
+		return fmt.Errorf("socks: %w", err)
+	}
+	if method == socks5.AuthTypeNotRequired {
+		return nil
+	}
+
+	request, err := socks5.ReadUsernamePasswordAuthRequest(reader)
+	if err != nil {
+		return fmt.Errorf("socks: %w", err)
+	}
+	password, ok := s.Users[request.Username]
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(request.Password)) != 1 {
+		socks5.WriteUsernamePasswordAuthResponse(conn, socks5.UsernamePasswordAuthResponse{
+			Status: socks5.UsernamePasswordStatusFailure,
+		})
+		return fmt.Errorf("%w: user %s", ErrAuth, request.Username)
+	}
+	err = socks5.WriteUsernamePasswordAuthResponse(conn, socks5.UsernamePasswordAuthResponse{
+		Status: socks5.UsernamePasswordStatusSuccess,
+	})
+	if err != nil {
+		return fmt.Errorf("socks: %w", err)
+	}
+	return nil
+}
+
+// Reply answers the request read by Handshake, bind is the address of the
+// udp relay of an association.
+func Reply(conn net.Conn, code byte, bind M.Socksaddr) error {
+	return socks5.WriteResponse(conn, socks5.Response{ReplyCode: code, Bind: bind})
+}
+
+// ReplyCodeForError returns the reply to a request whose dial failed.
+func ReplyCodeForError(err error) byte {
+	return socks5.ReplyCodeForError(err)
+}
+
+type requestKey struct{}
+
+// ContextWithRequest records the request read from a connection.
+func ContextWithRequest(ctx context.Context, request Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, request)
+}
+
+// RequestFromContext returns the request read from a connection, ok is
+// false if the connection is not a SOCKS5 one.
+func RequestFromContext(ctx context.Context) (request Request, ok bool) {
+	request, ok = ctx.Value(requestKey{}).(Request)
+	return request, ok
+}
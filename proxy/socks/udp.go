@@ -0,0 +1,71 @@
+package socks
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"sync/atomic"
+
+	"github.com/sagernet/sing/common/buf"
+	M "github.com/sagernet/sing/common/metadata"
+)
+
+// Association is the udp relay of a UDP ASSOCIATE request, it only serves
+// the host the request came from.
+type Association struct {
+	conn   *net.UDPConn
+	client netip.Addr
+	peer   atomic.Pointer[netip.AddrPort] // the latest source of the client
+}
+
+func NewAssociation(conn *net.UDPConn, client netip.Addr) *Association {
+	return &Association{conn: conn, client: client.Unmap()}
+}
+
+// ReadPacket reads the next datagram of the client into p and returns its
+// payload and destination. Datagrams of other hosts, fragments and
+// malformed ones are dropped.
+func (a *Association) ReadPacket(p []byte) ([]byte, M.Socksaddr, error) {
+	for {
+		n, source, err := a.conn.ReadFromUDPAddrPort(p)
+		if err != nil {
+			return nil, M.Socksaddr{}, err
+		}
+		// RSV(2) FRAG(1) ATYP DST.ADDR DST.PORT DATA
+		if source.Addr().Unmap() != a.client || n < 3 || p[2] != 0 {
+			continue
+		}
+		reader := bytes.NewReader(p[3:n])
+		destination, err := M.SocksaddrSerializer.ReadAddrPort(reader)
+		if err != nil {
+			continue
+		}
+		a.peer.Store(&source)
+		return p[n-reader.Len() : n], destination, nil
+	}
+}
+
+// WritePacket sends payload received from source to the client.
+func (a *Association) WritePacket(payload []byte, source M.Socksaddr) error {
+	peer := a.peer.Load()
+	if peer == nil {
+		return nil
+	}
+	buffer := buf.NewSize(3 + M.SocksaddrSerializer.AddrPortLen(source) + len(payload))
+	defer buffer.Release()
+	buffer.WriteZeroN(3)
+	if err := M.SocksaddrSerializer.WriteAddrPort(buffer, source); err != nil {
+		return err
+	}
+	buffer.Write(payload)
+	_, err := a.conn.WriteToUDPAddrPort(buffer.Bytes(), *peer)
+	return err
+}
+
+func (a *Association) LocalAddr() netip.AddrPort {
+	return a.conn.LocalAddr().(*net.UDPAddr).AddrPort()
+}
+
+func (a *Association) Close() error {
+	return a.conn.Close()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/daminit/traffics-cli/infra/logging"
+	"github.com/daminit/traffics-cli/infra/meta"
+	"github.com/daminit/traffics-cli/infra/networks/dialer"
+	"github.com/daminit/traffics-cli/proxy/inbounds"
+	"github.com/daminit/traffics-cli/proxy/outbounds"
+	"github.com/daminit/traffics-cli/proxy/sessions"
+	"github.com/daminit/traffics-cli/proxy/socks"
+	"github.com/sagernet/sing/common/buf"
+	M "github.com/sagernet/sing/common/metadata"
+	"github.com/sagernet/sing/protocol/socks/socks5"
+)
+
+// SocksTable holds the udp sessions of an association by destination.
+type SocksTable = sessions.Table[M.Socksaddr, *UDPConnWrapper]
+
+// SocksHandler serves the requests read by the SOCKS5 server of in, every
+// destination is dialed with the dialer of out.
+func (t *TrafficHandler) SocksHandler(
+	in *inbounds.Inbound,
+	out *outbounds.Outbound,
+	udpOptions sessions.Options[M.Socksaddr, *UDPConnWrapper],
+	ttl time.Duration,
+) inbounds.ConnHandler {
+	tcpCounters := t.metrics.relay(meta.ProtocolTCP, in.Name, remoteLabel(out))
+	udpCounters := t.metrics.relay(meta.ProtocolUDP, in.Name, remoteLabel(out))
+	return inbounds.FuncConnHandler(func(ctx context.Context, local net.Conn) {
+		defer local.Close()
+		request, _ := socks.RequestFromContext(ctx)
+		switch request.Command {
+		case socks5.CommandConnect:
+			t.relayConn(ctx, in, out, tcpCounters, local, func(ctx context.Context) (net.Conn, error) {
+				remote, err := out.DialAddress(ctx, string(meta.ProtocolTCP), request.Destination.String())
+				if err != nil {
+					socks.Reply(local, socks.ReplyCodeForError(err), M.Socksaddr{})
+					return nil, err
+				}
+				if err = socks.Reply(local, socks5.ReplyCodeSuccess, M.SocksaddrFromNet(remote.LocalAddr())); err != nil {
+					remote.Close()
+					return nil, err
+				}
+				return remote, nil
+			})
+		case socks5.CommandUDPAssociate:
+			t.associate(ctx, in, out, udpCounters, local, sessions.NewTable(udpOptions), ttl)
+		}
+	})
+}
+
+// associate relays the datagrams of the client of a UDP ASSOCIATE request
+// until its control connection local is closed.
+func (t *TrafficHandler) associate(
+	ctx context.Context,
+	in *inbounds.Inbound,
+	out *outbounds.Outbound,
+	counters *relayCounters,
+	local net.Conn,
+	udpSessions *SocksTable,
+	ttl time.Duration,
+) {
+	defer udpSessions.Close()
+	source := M.AddrPortFromNet(local.RemoteAddr())
+	udpConn, err := in.Listener.ListenUDP(ctx, in.Address, 0)
+	if err != nil {
+		in.Logger.ErrorContext(ctx, "listen udp association failed", logging.AttrError(err))
+		socks.Reply(local, socks5.ReplyCodeFailure, M.Socksaddr{})
+		return
+	}
+	association := socks.NewAssociation(udpConn, source.Addr())
+	defer association.Close()
+
+	bind := association.LocalAddr()
+	if bind.Addr().IsUnspecified() {
+		// the client reaches the relay where it reached the bind
+		bind = netip.AddrPortFrom(M.AddrPortFromNet(local.LocalAddr()).Addr(), bind.Port())
+	}
+	if err = socks.Reply(local, socks5.ReplyCodeSuccess, M.SocksaddrFromNetIP(bind)); err != nil {
+		return
+	}
+	go func() {
+		// the client must not send anything else on the control connection
+		io.Copy(io.Discard, local)
+		association.Close()
+	}()
+	defer context.AfterFunc(ctx, func() { local.Close() })()
+
+	buffer := make([]byte, in.UDPBufferSize)
+	for {
+		payload, destination, err := association.ReadPacket(buffer)
+		if err != nil {
+			return
+		}
+		if !in.Socks.Allow.Allowed(destination) {
+			in.Reject(meta.ProtocolUDP, source, inbounds.RejectReasonDestination)
+			continue
+		}
+		if connWrapper, hit := udpSessions.Load(destination); hit {
+			connWrapper.countUpload(len(payload))
+			if _, err := connWrapper.Conn.Write(payload); err != nil {
+				connWrapper.Logger.ErrorContext(ctx, "write message error", logging.AttrError(err))
+			}
+			continue
+		}
+		if !in.AdmitSession(source) {
+			continue
+		}
+
+		conn, err := out.DialAddress(ctx, string(meta.ProtocolUDP), destination.String())
+		if err != nil {
+			t.metrics.dialFailures.With(in.Name, remoteLabel(out), dialer.FailureReason(err)).Add(1)
+			in.Logger.ErrorContext(ctx, "dial new udp connection failed", logging.AttrError(err))
+			continue
+		}
+		newConn := &UDPConnWrapper{
+			Logger:     in.Logger.With(logging.AttrIdRandom()),
+			Writer:     associationWriter{association: association, destination: destination},
+			Conn:       conn,
+			ReadBuffer: buf.NewSize(in.UDPBufferSize),
+			Counters:   counters,
+			Start:      time.Now(),
+		}
+		if err := udpSessions.Store(destination, newConn); err != nil {
+			t.dropUDPSession(in, inbounds.Peer{Addr: source}, newConn, len(payload), err)
+			continue
+		}
+
+		counters.Active.Add(1)
+		go t.newUdpLoop(inbounds.Peer{Addr: source}, newConn, func() { udpSessions.CompareAndDelete(destination, newConn) }, ttl)
+		newConn.Logger.DebugContext(ctx, "new udp connection established",
+			slog.String("source", source.String()),
+			slog.String("destination", destination.String()),
+		)
+
+		newConn.countUpload(len(payload))
+		if _, err = conn.Write(payload); err != nil {
+			newConn.Logger.ErrorContext(ctx, "write udp message failed", logging.AttrError(err))
+		}
+	}
+}
+
+// associationWriter sends the replies of destination to the client of an
+// association.
+type associationWriter struct {
+	association *socks.Association
+	destination M.Socksaddr
+}
+
+func (w associationWriter) WritePacket(bs []byte, _ netip.AddrPort) {
+	// the client may be gone already, udp is best effort anyway
+	w.association.WritePacket(bs, w.destination)
+}
@@ -3,23 +3,36 @@ package main
 import (
 	"cmp"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/daminit/traffics-cli/infra/constant"
 	"github.com/daminit/traffics-cli/infra/logging"
 	"github.com/daminit/traffics-cli/infra/meta"
+	"github.com/daminit/traffics-cli/infra/networks/acl"
 	"github.com/daminit/traffics-cli/infra/networks/dialer"
 	"github.com/daminit/traffics-cli/infra/networks/listener"
+	"github.com/daminit/traffics-cli/infra/networks/proxyproto"
 	"github.com/daminit/traffics-cli/infra/networks/resolve"
+	"github.com/daminit/traffics-cli/infra/networks/tlsconf"
 	"github.com/daminit/traffics-cli/proxy/inbounds"
 	"github.com/daminit/traffics-cli/proxy/outbounds"
+	"github.com/daminit/traffics-cli/proxy/route"
+	"github.com/daminit/traffics-cli/proxy/sessions"
+	"github.com/sagernet/sing/common"
 	"github.com/sagernet/sing/common/buf"
 	"github.com/sagernet/sing/common/bufio"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"io"
 	"log/slog"
 	"net"
 	"net/netip"
 	"os"
+	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -28,20 +41,21 @@ type Traffics struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	config         Config
-	logger         *slog.Logger
-	nameToOutbound map[string]*outbounds.Outbound
-	nameToInbound  map[string]*inbounds.Inbound
-	udpConnTrack   map[netip.AddrPort]UDPConnWrapper
+	mu                sync.Mutex // serializes Reload and Close
+	config            Config
+	logger            *slog.Logger
+	metrics           *trafficMetrics
+	stopMetrics       func()
+	accessLog         *logging.AccessLogger
+	nameToOutbound    map[string]*outbounds.Outbound
+	nameToInbound     map[string]*inbounds.Inbound
+	nameToUDPSessions map[string]*UDPSessionTable
+	direct            *outbounds.Outbound // dials the destinations of socks5 binds without remote
+	hosts             *resolve.Hosts      // shared by the resolvers of every remote
 }
 
 func NewTraffics(config Config) (*Traffics, error) {
-	t := &Traffics{}
-	t.config = config
-
-	t.nameToOutbound = make(map[string]*outbounds.Outbound)
-	t.nameToInbound = make(map[string]*inbounds.Inbound)
-	t.udpConnTrack = make(map[netip.AddrPort]UDPConnWrapper)
+	t := &Traffics{metrics: newTrafficMetrics()}
 
 	var err error
 	t.logger, err = newLogger(config.Log)
@@ -49,35 +63,161 @@ func NewTraffics(config Config) (*Traffics, error) {
 		return nil, fmt.Errorf("traffics(logger): %w", err)
 	}
 
+	t.accessLog, err = logging.NewAccessLogger(config.AccessLog.Path, config.AccessLog.Format)
+	if err != nil {
+		return nil, fmt.Errorf("traffics(access_log): %w", err)
+	}
+
+	t.hosts, err = config.hosts()
+	if err != nil {
+		t.accessLog.Close()
+		return nil, fmt.Errorf("traffics(hosts): %w", err)
+	}
+	if err = t.init(config, nil); err != nil {
+		t.accessLog.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// init builds every outbound and inbound of config, the ones found in
+// previous with an unchanged configuration are reused as is.
+func (t *Traffics) init(config Config, previous *Traffics) error {
 	if len(config.Remote) == 1 && len(config.Binds) == 1 && config.Binds[0].Remote == "" {
 		config.Binds[0].Remote = config.Remote[0].Name
 	}
+	var binds []BindConfig
+	for _, bind := range config.Binds {
+		binds = append(binds, bind.expand()...)
+	}
+	config.Binds = binds
 
-	err = t.initOutbound() // init outbounds first
+	t.config = config
+	t.nameToOutbound = make(map[string]*outbounds.Outbound)
+	t.nameToInbound = make(map[string]*inbounds.Inbound)
+	t.nameToUDPSessions = make(map[string]*UDPSessionTable)
+
+	err := t.initOutbound(previous) // init outbounds first
 	if err != nil {
-		return nil, fmt.Errorf("traffics(init_outbound): %w", err)
+		return fmt.Errorf("traffics(init_outbound): %w", err)
 	}
-	err = t.initInbound()
+	err = t.initInbound(previous)
 	if err != nil {
-		return nil, fmt.Errorf("traffics(init_inbound): %w", err)
+		return fmt.Errorf("traffics(init_inbound): %w", err)
 	}
+	return nil
+}
 
-	return t, nil
+// Reload applies config to a started Traffics. Binds and remotes whose
+// configuration is unchanged keep running along with their connections,
+// the others are stopped, replaced or started. The running configuration
+// is kept as is if config is invalid.
+func (t *Traffics) Reload(config Config) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// handlers of next share the context of t, so they live as long as
+	// the ones built by NewTraffics.
+	next := &Traffics{ctx: t.ctx, cancel: t.cancel, logger: t.logger, metrics: t.metrics, accessLog: t.accessLog, hosts: t.hosts}
+	hosts, err := config.hosts()
+	if err != nil {
+		return fmt.Errorf("traffics(hosts): %w", err)
+	}
+	if err := next.init(config, t); err != nil {
+		return err
+	}
+	if next.config.AccessLog != t.config.AccessLog {
+		// handlers kept by next share the access log, so it changes in place
+		err = t.accessLog.Reopen(next.config.AccessLog.Path, next.config.AccessLog.Format)
+		if err != nil {
+			return fmt.Errorf("traffics(access_log): %w", err)
+		}
+	}
+	t.hosts.Replace(hosts)
+
+	for name, in := range t.nameToInbound {
+		if next.nameToInbound[name] != in {
+			in.Close()
+			t.nameToUDPSessions[name].Close()
+			t.logger.InfoContext(t.ctx, "bind stopped", slog.String("listener", name))
+		}
+	}
+	for name, out := range t.nameToOutbound {
+		if next.nameToOutbound[name] != out {
+			out.Close()
+		}
+	}
+	for name, out := range next.nameToOutbound {
+		if t.nameToOutbound[name] != out {
+			out.Start(t.ctx)
+		}
+	}
+	var errs []error
+	for name, in := range next.nameToInbound {
+		if t.nameToInbound[name] == in {
+			continue
+		}
+		if err := in.Start(t.ctx); err != nil {
+			in.Close()
+			// dropped from the running set, so the next reload retries it
+			delete(next.nameToInbound, name)
+			delete(next.nameToUDPSessions, name)
+			errs = append(errs, fmt.Errorf("traffics(reload): %s: %w", name, err))
+		}
+	}
+	if next.config.Metrics != t.config.Metrics {
+		if t.stopMetrics != nil {
+			t.stopMetrics()
+		}
+		t.stopMetrics, err = t.metrics.serve(t.ctx, t.logger, next.config.Metrics)
+		if err != nil {
+			t.stopMetrics = nil
+			// not served, so the next reload retries it
+			next.config.Metrics = MetricsConfig{}
+			errs = append(errs, fmt.Errorf("traffics(metrics): %w", err))
+		}
+	}
+
+	t.config = next.config
+	t.nameToOutbound = next.nameToOutbound
+	t.nameToInbound = next.nameToInbound
+	t.nameToUDPSessions = next.nameToUDPSessions
+	return errors.Join(errs...)
 }
 
 func (t *Traffics) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.cancel()
-	for _, c := range t.udpConnTrack {
-		c.Conn.Close()
+	if t.stopMetrics != nil {
+		t.stopMetrics()
+	}
+	for _, c := range t.nameToUDPSessions {
+		c.Close()
 	}
 	for _, c := range t.nameToInbound {
 		c.Close()
 	}
+	for _, c := range t.nameToOutbound {
+		c.Close()
+	}
+	t.accessLog.Close()
 	return nil
 }
 
 func (t *Traffics) Start(ctx context.Context) error {
 	t.ctx, t.cancel = context.WithCancel(ctx)
+	var err error
+	t.stopMetrics, err = t.metrics.serve(t.ctx, t.logger, t.config.Metrics)
+	if err != nil {
+		return fmt.Errorf("traffics(metrics): %w", err)
+	}
+	go t.hosts.Watch(t.ctx, constant.DefaultHostsWatchInterval, func(err error) {
+		t.logger.ErrorContext(t.ctx, "reload hosts failed", logging.AttrError(err))
+	})
+	for _, out := range t.nameToOutbound {
+		out.Start(t.ctx)
+	}
 	for _, in := range t.nameToInbound {
 		err := in.Start(t.ctx)
 		if err != nil {
@@ -87,11 +227,19 @@ func (t *Traffics) Start(ctx context.Context) error {
 	return nil
 }
 
-func (t *Traffics) initOutbound() error {
-	var (
-		defaultResolver resolve.Resolver = resolve.NewCachedResolverFromResolver(resolve.NewSystemResolver(),
-			constant.DefaultResolverCacheSize, constant.DefaultResolverCacheTTL)
-	)
+func (t *Traffics) initOutbound(previous *Traffics) error {
+	defaultResolver := resolve.NewCachedResolverFromResolver(resolve.NewSystemResolver(),
+		constant.DefaultResolverCacheSize, constant.DefaultResolverCacheTTL)
+	defaultResolver.SetStats(t.metrics.resolverHits.With("system"), t.metrics.resolverMisses.With("system"))
+
+	directDialer, err := dialer.NewDefault(dialer.DialConfig{Resolver: resolve.NewHostsResolver(t.hosts, defaultResolver)})
+	if err != nil {
+		return err
+	}
+	t.direct = &outbounds.Outbound{
+		Dialer: directDialer,
+		Logger: t.logger.With(slog.String("remote", remoteDirect)),
+	}
 
 	// build dialer first
 	for _, v := range t.config.Remote {
@@ -103,12 +251,22 @@ func (t *Traffics) initOutbound() error {
 		if _, ok := t.nameToOutbound[v.Name]; ok {
 			return fmt.Errorf("duplicated remote name: %s", v.Name)
 		}
+		if previous != nil && previous.unchangedRemote(t.config, v.Name) {
+			t.nameToOutbound[v.Name] = previous.nameToOutbound[v.Name]
+			continue
+		}
 
-		realResolver := defaultResolver
-		if v.DNS != "" {
-			realResolver = resolve.NewCachedResolverFromExchanger(
-				resolve.NewRawClient(net.Dialer{}, v.DNS), constant.DefaultResolverCacheSize)
+		var realResolver resolve.Resolver = defaultResolver
+		client, err := v.dnsClient()
+		if err != nil {
+			return fmt.Errorf("remote %s: %w", v.Name, err)
 		}
+		if client != nil {
+			cachedResolver := resolve.NewCachedResolverFromExchanger(client, constant.DefaultResolverCacheSize)
+			cachedResolver.SetStats(t.metrics.resolverHits.With(v.Name), t.metrics.resolverMisses.With(v.Name))
+			realResolver = cachedResolver
+		}
+		realResolver = resolve.NewHostsResolver(t.hosts, realResolver)
 		var bind4, bind6 netip.Addr
 		bind4 = v.BindAddress4
 		bind6 = v.BindAddress6
@@ -128,37 +286,159 @@ func (t *Traffics) initOutbound() error {
 		if err != nil {
 			return err
 		}
+		var remoteDialer dialer.Dialer = dd
+		if v.Via != "" {
+			remoteDialer, err = dialer.NewProxy(dd, dialer.ProxyConfig{
+				URL:      v.Via,
+				Header:   v.viaHeader(),
+				Timeout:  v.Timeout,
+				Resolver: realResolver,
+				Strategy: v.Strategy,
+			})
+			if err != nil {
+				return fmt.Errorf("remote %s: %w", v.Name, err)
+			}
+		}
+		balancer, err := outbounds.NewBalancer(v.Balance)
+		if err != nil {
+			return err
+		}
+		var servers []*outbounds.Server
+		for _, s := range v.Upstreams() {
+			address := s.Server // socket path of unix remotes
+			if v.Network == "" {
+				address = net.JoinHostPort(s.Server, strconv.FormatUint(uint64(s.Port), 10))
+			}
+			servers = append(servers, &outbounds.Server{
+				Address: address,
+				Weight:  cmp.Or(s.Weight, 1),
+			})
+		}
+		healthCheck, err := v.healthCheck()
+		if err != nil {
+			return fmt.Errorf("remote %s: %w", v.Name, err)
+		}
+		var proxyProtocol proxyproto.Version
+		if v.ProxyProtocol != "" {
+			proxyProtocol, err = proxyproto.ParseVersion(v.ProxyProtocol)
+			if err != nil {
+				return fmt.Errorf("remote %s: %w", v.Name, err)
+			}
+		}
+		var tlsConfig *tls.Config
+		if v.TLS {
+			tlsConfig, err = tlsconf.NewClient(tlsconf.ClientOptions{
+				ServerName:         v.SNI,
+				CAFile:             v.CAFile,
+				InsecureSkipVerify: v.InsecureSkipVerify,
+				ClientCert:         v.ClientCert,
+				ClientKey:          v.ClientKey,
+				ALPN:               v.ALPN,
+			})
+			if err != nil {
+				return fmt.Errorf("remote %s: %w", v.Name, err)
+			}
+		}
 		t.nameToOutbound[v.Name] = &outbounds.Outbound{
-			Dialer:  dd,
-			Address: net.JoinHostPort(v.Server, strconv.FormatUint(uint64(v.Port), 10)),
-			Logger:  t.logger.With(slog.String("remote", v.Name)),
+			Name:          v.Name,
+			Dialer:        remoteDialer,
+			Servers:       servers,
+			Balancer:      balancer,
+			HealthCheck:   healthCheck,
+			ProxyProtocol: proxyProtocol,
+			Network:       v.Network,
+			DNS:           client,
+			TLS:           tlsConfig,
+			Logger:        t.logger.With(slog.String("remote", v.Name)),
+		}
+	}
+
+	// link backups after every outbound is built
+	for _, v := range t.config.Remote {
+		if v.Backup == "" || previous != nil && previous.nameToOutbound[v.Name] == t.nameToOutbound[v.Name] {
+			continue
+		}
+		backup, ok := t.nameToOutbound[v.Backup]
+		if !ok {
+			return fmt.Errorf("backup remote not found with name: %s", v.Backup)
+		}
+		t.nameToOutbound[v.Name].Backup = backup
+	}
+	for name, out := range t.nameToOutbound {
+		for seen, next := 0, out.Backup; next != nil; seen, next = seen+1, next.Backup {
+			if next == out || seen > len(t.nameToOutbound) {
+				return fmt.Errorf("backup loop detected for remote: %s", name)
+			}
 		}
 	}
 	return nil
 }
 
-func (t *Traffics) initInbound() error {
+func (t *Traffics) initInbound(previous *Traffics) error {
 	// parse listener
 	for _, v := range t.config.Binds {
 
-		var name = v.Name
-		if v.Name == "" {
-			name = "(" + net.JoinHostPort(v.Listen, strconv.FormatUint(uint64(v.Port), 10)) + ")"
-		}
+		var name = v.displayName()
 		if _, exist := t.nameToInbound[name]; exist {
 			return fmt.Errorf("duplicated bind: %s", name)
 		}
+		if previous != nil && previous.unchangedBind(v, t.nameToOutbound) {
+			t.nameToInbound[name] = previous.nameToInbound[name]
+			t.nameToUDPSessions[name] = previous.nameToUDPSessions[name]
+			continue
+		}
 
-		if v.Remote == "" {
+		stream := v.Network.ContainsProtocol(meta.ProtocolTCP) || v.Network.ContainsProtocol(meta.ProtocolUnix)
+		packet := v.Network.ContainsProtocol(meta.ProtocolUDP) || v.Network.ContainsProtocol(meta.ProtocolUnixgram)
+		socksMode := v.Mode == bindModeSocks5
+		if v.Remote == "" && !socksMode && (packet || !v.hasRoutes()) {
 			return fmt.Errorf("no remote specified for %s", name)
 		}
 
 		logger := t.logger.With(slog.String("listener", name))
-		outbound, ok := t.nameToOutbound[v.Remote]
-		if !ok {
-			return fmt.Errorf("remote not found with name: %s", v.Remote)
+		targets := make(map[string]relayTarget)
+		for _, remoteName := range v.remotes() {
+			outbound, ok := t.nameToOutbound[remoteName]
+			if !ok {
+				return fmt.Errorf("remote not found with name: %s", remoteName)
+			}
+			if socksMode {
+				if outbound.Network != "" || outbound.TLS != nil || outbound.ProxyProtocol != 0 {
+					return fmt.Errorf("bind %s: remote %s of a socks5 bind can not use unix sockets, tls or proxy protocol", name, remoteName)
+				}
+				targets[remoteName] = relayTarget{out: outbound}
+				continue
+			}
+			if len(outbound.Servers) == 0 {
+				return fmt.Errorf("bind %s: remote %s has no server", name, remoteName)
+			}
+			portOffsets, err := v.portOffsets(t.config.Remote, remoteName)
+			if err != nil {
+				return fmt.Errorf("bind %s: %w", name, err)
+			}
+			// udp only goes to the default remote
+			if err = checkTarget(v.Network, outbound, stream, packet && remoteName == v.Remote); err != nil {
+				return fmt.Errorf("bind %s: %w", name, err)
+			}
+			targets[remoteName] = relayTarget{out: outbound, portOffsets: portOffsets}
 		}
+		if socksMode && v.Remote == "" {
+			targets[""] = relayTarget{out: t.direct}
+		}
+		// routed connections and udp go to the default remote
+		defaultTarget, hasDefault := targets[v.Remote]
+		if hasDefault {
+			targets[""] = defaultTarget
+		}
+		var err error
 
+		var unixMode os.FileMode
+		if v.UnixMode != "" {
+			unixMode, err = listener.ParseMode(v.UnixMode)
+			if err != nil {
+				return fmt.Errorf("bind %s: %w", name, err)
+			}
+		}
 		li := listener.NewListener(listener.Options{
 			Family:      v.Family,
 			Interface:   v.Interface,
@@ -166,36 +446,210 @@ func (t *Traffics) initInbound() error {
 			TFO:         v.TFO,
 			MPTCP:       v.MPTCP,
 			UDPFragment: v.UDPFragment,
+			UnixMode:    unixMode,
+			UnixOwner:   v.UnixOwner,
 		})
 
 		inbound := &inbounds.Inbound{
+			Name:          name,
 			Logger:        logger,
 			Listener:      li,
 			Protocols:     v.Network,
 			Address:       v.Listen,
 			Port:          v.Port,
 			UDPBufferSize: cmp.Or(v.UDPBufferSize, constant.DefaultUDPReadBufferSize),
+
+			ProxyProtocol:        v.ProxyProtocol,
+			ProxyProtocolTrusted: v.ProxyProtocolTrusted,
+			ProxyProtocolTimeout: v.ProxyProtocolTimeout,
+
+			MaxConns:       v.MaxConns,
+			MaxConnsPerIP:  v.MaxConnsPerIP,
+			ConnRate:       v.ConnRate,
+			UDPSessionRate: v.UDPSessionRate,
+
+			RejectLogInterval: v.RejectLogInterval,
+			OnReject: func(protocol meta.Protocol, _ netip.AddrPort, reason string) {
+				t.metrics.rejected.With(name, protocol.String(), reason).Add(1)
+			},
+		}
+		if v.hasRoutes() {
+			inbound.Router = route.New(route.Options{
+				Default:    v.Remote,
+				Protocols:  v.ProtocolRoutes,
+				SNI:        v.SNIRoutes,
+				HTTP:       v.HTTPRoutes,
+				HeaderSize: v.RouteHeaderSize,
+				Timeout:    v.RouteTimeout,
+			})
+		}
+		if v.hasTLS() {
+			minVersion, _ := tlsconf.ParseVersion(v.TLSMinVersion)
+			options := tlsconf.ServerOptions{MinVersion: minVersion, ALPN: v.TLSALPN}
+			for i := range v.TLSCert {
+				options.Certificates = append(options.Certificates, tlsconf.KeyPair{Cert: v.TLSCert[i], Key: v.TLSKey[i]})
+			}
+			inbound.TLS, err = tlsconf.NewServer(options)
+			if err != nil {
+				return fmt.Errorf("bind %s: %w", name, err)
+			}
+		}
+		if v.hasACL() {
+			var err error
+			inbound.ACL, err = acl.New(acl.Options{
+				Allow:     v.Allow,
+				Deny:      v.Deny,
+				AllowFile: v.AllowFile,
+				DenyFile:  v.DenyFile,
+			})
+			if err != nil {
+				return fmt.Errorf("bind %s: %w", name, err)
+			}
 		}
 
-		inbound.PacketHandler = (*TrafficHandler)(t).PacketHandler(
-			v.Network.ContainsProtocol(meta.ProtocolUDP),
-			inbound, outbound, v.UDPKeepaliveTTL)
-		inbound.ConnHandler = (*TrafficHandler)(t).ConnHandler(
-			v.Network.ContainsProtocol(meta.ProtocolTCP),
-			inbound, outbound)
+		overflow, err := sessions.ParseOverflowPolicy(v.UDPOverflow)
+		if err != nil {
+			return fmt.Errorf("bind %s: %w", name, err)
+		}
+		udpSessions := sessions.NewTable(sessions.Options[inbounds.Peer, *UDPConnWrapper]{
+			MaxSize:  v.UDPMaxSessions,
+			Overflow: overflow,
+			OnEvict: func(_ inbounds.Peer, c *UDPConnWrapper) {
+				// only unblock the read loop, it will release the rest.
+				c.Conn.Close()
+			},
+		})
+
+		if socksMode {
+			inbound.Socks, err = v.socksServer()
+			if err != nil {
+				return fmt.Errorf("bind %s: %w", name, err)
+			}
+			inbound.ConnHandler = (*TrafficHandler)(t).SocksHandler(inbound, defaultTarget.out,
+				sessions.Options[M.Socksaddr, *UDPConnWrapper]{
+					MaxSize:  v.UDPMaxSessions,
+					Overflow: overflow,
+					OnEvict: func(_ M.Socksaddr, c *UDPConnWrapper) {
+						c.Conn.Close()
+					},
+				}, v.UDPKeepaliveTTL)
+		} else {
+			inbound.PacketHandler = (*TrafficHandler)(t).PacketHandler(
+				packet, inbound, defaultTarget, udpSessions, v.UDPKeepaliveTTL)
+			inbound.ConnHandler = (*TrafficHandler)(t).ConnHandler(
+				stream, inbound, targets)
+		}
 
 		t.nameToInbound[name] = inbound
+		t.nameToUDPSessions[name] = udpSessions
 	}
 	return nil
 }
 
+// checkTarget reports whether out and every backup of it, which take
+// over its connections, can carry the streams and packets of a bind on
+// network.
+func checkTarget(network meta.ProtocolList, out *outbounds.Outbound, stream, packet bool) error {
+	for ; out != nil; out = out.Backup {
+		if stream && out.Network != "" && !out.Network.IsStream() {
+			return fmt.Errorf("network %s can not be forwarded to %s remote %s", network, out.Network, out.Name)
+		}
+		if !packet {
+			continue
+		}
+		if out.ProxyProtocol == proxyproto.Version1 {
+			return fmt.Errorf("remote %s sends proxy protocol v1 which does not support udp", out.Name)
+		}
+		if out.TLS != nil {
+			return fmt.Errorf("remote %s originates tls which does not support udp", out.Name)
+		}
+		if dialer.IsStreamProxy(out.Dialer) {
+			return fmt.Errorf("remote %s is reached through an http proxy which does not support udp", out.Name)
+		}
+		if out.Network.IsStream() {
+			return fmt.Errorf("network %s can not be forwarded to %s remote %s", network, out.Network, out.Name)
+		}
+	}
+	return nil
+}
+
+// unchangedRemote reports whether the running remote called name can be
+// kept for config, which requires its backup chain to be unchanged as well.
+func (t *Traffics) unchangedRemote(config Config, name string) bool {
+	for seen := 0; name != "" && seen <= len(config.Remote); seen++ {
+		if _, running := t.nameToOutbound[name]; !running {
+			return false
+		}
+		idx := slices.IndexFunc(config.Remote, func(c RemoteConfig) bool { return c.Name == name })
+		old := slices.IndexFunc(t.config.Remote, func(c RemoteConfig) bool { return c.Name == name })
+		if idx < 0 || old < 0 || !config.Remote[idx].equal(t.config.Remote[old]) {
+			return false
+		}
+		name = config.Remote[idx].Backup
+	}
+	return name == ""
+}
+
+// unchangedBind reports whether the running bind of the same name can be
+// kept for config, outbounds are the ones config is going to use.
+func (t *Traffics) unchangedBind(config BindConfig, outbounds map[string]*outbounds.Outbound) bool {
+	name := config.displayName()
+	in, running := t.nameToInbound[name]
+	if !running || in == nil {
+		return false
+	}
+	for _, old := range t.config.Binds {
+		if old.displayName() == name {
+			return old.equal(config) && !slices.ContainsFunc(config.remotes(), func(remote string) bool {
+				return t.nameToOutbound[remote] != outbounds[remote]
+			})
+		}
+	}
+	return false
+}
+
+// remoteLabel names out in metrics and access logs.
+func remoteLabel(out *outbounds.Outbound) string {
+	return cmp.Or(out.Name, remoteDirect)
+}
+
+// relayTarget is a remote a bind forwards to.
+type relayTarget struct {
+	out         *outbounds.Outbound
+	portOffsets map[string]uint16 // of out and its backups
+}
+
 type TrafficHandler Traffics
 
+type UDPSessionTable = sessions.Table[inbounds.Peer, *UDPConnWrapper]
+
 type UDPConnWrapper struct {
 	Logger     logging.ContextLogger
 	Writer     inbounds.PacketWriter
-	Conn       *net.UDPConn
+	Conn       net.Conn
 	ReadBuffer *buf.Buffer
+	Counters   *relayCounters
+	Start      time.Time
+
+	// per session statistics
+	uploadBytes     atomic.Int64
+	downloadBytes   atomic.Int64
+	uploadPackets   atomic.Int64
+	downloadPackets atomic.Int64
+}
+
+func (c *UDPConnWrapper) countUpload(n int) {
+	c.Counters.UploadPackets.Add(1)
+	c.Counters.UploadBytes.Add(int64(n))
+	c.uploadPackets.Add(1)
+	c.uploadBytes.Add(int64(n))
+}
+
+func (c *UDPConnWrapper) countDownload(n int) {
+	c.Counters.DownloadPackets.Add(1)
+	c.Counters.DownloadBytes.Add(int64(n))
+	c.downloadPackets.Add(1)
+	c.downloadBytes.Add(int64(n))
 }
 
 func (c *UDPConnWrapper) Close() {
@@ -206,24 +660,30 @@ func (c *UDPConnWrapper) Close() {
 func (t *TrafficHandler) PacketHandler(
 	enable bool,
 	in *inbounds.Inbound,
-	out *outbounds.Outbound,
+	target relayTarget,
+	udpSessions *UDPSessionTable,
 	ttl time.Duration,
 ) inbounds.PacketHandler {
 	if !enable {
 		return nil
 	}
+	out, portOffsets := target.out, target.portOffsets
 
-	var newUDPConn = func(conn *net.UDPConn) UDPConnWrapper {
-		return UDPConnWrapper{
+	counters := t.metrics.relay(meta.ProtocolUDP, in.Name, remoteLabel(out))
+	var newUDPConn = func(conn net.Conn, pw inbounds.PacketWriter) *UDPConnWrapper {
+		return &UDPConnWrapper{
 			Logger:     in.Logger.With(logging.AttrIdRandom()),
-			Writer:     in,
+			Writer:     pw,
 			Conn:       conn,
 			ReadBuffer: buf.NewSize(in.UDPBufferSize),
+			Counters:   counters,
+			Start:      time.Now(),
 		}
 	}
 
-	return inbounds.FuncPacketHandler(func(p []byte, remote netip.AddrPort, pw inbounds.PacketWriter) {
-		if connWrapper, hit := t.udpConnTrack[remote]; hit {
+	return inbounds.FuncPacketHandler(func(p []byte, peer inbounds.Peer, local netip.AddrPort, pw inbounds.PacketWriter) {
+		if connWrapper, hit := udpSessions.Load(peer); hit {
+			connWrapper.countUpload(len(p))
 			_, err := connWrapper.Conn.Write(p)
 			if err != nil {
 				connWrapper.Logger.ErrorContext(t.ctx, "write message error",
@@ -231,47 +691,88 @@ func (t *TrafficHandler) PacketHandler(
 			}
 			return
 		}
+		// unix peers have no address for the per source limits
+		if peer.Addr.IsValid() && !in.AdmitSession(peer.Addr) {
+			return
+		}
 
-		conn, err := out.DialContext(t.ctx, string(meta.ProtocolUDP))
+		ctx := meta.ContextWithMetadata(t.ctx, meta.Metadata{
+			Source:      peer.Addr,
+			Destination: local, // an unknown one makes a LOCAL header
+			PortOffsets: portOffsets,
+		})
+		conn, err := out.DialContext(ctx, string(meta.ProtocolUDP))
 		if err != nil {
+			t.metrics.dialFailures.With(in.Name, remoteLabel(out), dialer.FailureReason(err)).Add(1)
 			in.Logger.ErrorContext(t.ctx, "dial new udp connection failed",
 				logging.AttrError(err),
 			)
+			t.accessLog.Log(logging.AccessRecord{
+				Network:       meta.ProtocolUDP.String(),
+				Bind:          in.Name,
+				Remote:        remoteLabel(out),
+				Client:        peer.String(),
+				Start:         time.Now(),
+				UploadBytes:   int64(len(p)),
+				UploadPackets: 1,
+				Reason:        logging.CloseReasonError,
+			})
 			return
 		}
 
-		if udpConn, ok := conn.(*net.UDPConn); ok {
-			newConn := newUDPConn(udpConn)
-			t.udpConnTrack[remote] = newConn
-
-			go t.newUdpLoop(remote, newConn, ttl)
-			if newConn.Logger.Enabled(t.ctx, slog.LevelDebug) {
-				newConn.Logger.DebugContext(t.ctx, "new udp connection established",
-					slog.String("source", remote.String()),
-					slog.String("remote", udpConn.RemoteAddr().String()),
-					slog.String("local", udpConn.LocalAddr().String()),
-				)
-			}
-
-			_, err = udpConn.Write(p)
-			if err != nil {
+		newConn := newUDPConn(conn, pw)
+		if !peer.CanReply() {
+			// nothing comes back to an unbound client, so every datagram
+			// of it is a session of its own
+			newConn.countUpload(len(p))
+			reason := logging.CloseReasonClientEOF
+			if _, err = conn.Write(p); err != nil {
 				newConn.Logger.ErrorContext(t.ctx, "write udp message failed",
 					logging.AttrError(err))
+				reason = logging.CloseReasonError
 			}
-		} else {
-			panic("DialContext in udp network returned a non-udpConn")
+			newConn.Close()
+			t.logUDPSession(peer, newConn, reason)
+			return
+		}
+		if err := udpSessions.Store(peer, newConn); err != nil {
+			t.dropUDPSession(in, peer, newConn, len(p), err)
+			return
+		}
+
+		counters.Active.Add(1)
+		go t.newUdpLoop(peer, newConn, func() { udpSessions.CompareAndDelete(peer, newConn) }, ttl)
+		if newConn.Logger.Enabled(t.ctx, slog.LevelDebug) {
+			newConn.Logger.DebugContext(t.ctx, "new udp connection established",
+				slog.String("source", peer.String()),
+				slog.String("remote", conn.RemoteAddr().String()),
+				slog.String("local", conn.LocalAddr().String()),
+			)
+		}
+
+		newConn.countUpload(len(p))
+		_, err = conn.Write(p)
+		if err != nil {
+			newConn.Logger.ErrorContext(t.ctx, "write udp message failed",
+				logging.AttrError(err))
 		}
 	})
 }
 
+// newUdpLoop relays the replies of proxyConn to client until ttl passes
+// without any, release drops proxyConn from its session table.
 func (t *TrafficHandler) newUdpLoop(
-	client netip.AddrPort,
-	proxyConn UDPConnWrapper,
+	client inbounds.Peer,
+	proxyConn *UDPConnWrapper,
+	release func(),
 	ttl time.Duration,
 ) {
+	reason := logging.CloseReasonError
 	defer func() {
-		delete(t.udpConnTrack, client)
+		release()
 		proxyConn.Close()
+		proxyConn.Counters.Active.Add(-1)
+		t.logUDPSession(client, proxyConn, reason)
 
 		proxyConn.Logger.DebugContext(t.ctx, "udp connection closed")
 	}()
@@ -299,46 +800,194 @@ func (t *TrafficHandler) newUdpLoop(
 				// expires:
 				goto again
 			}
+			switch {
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				proxyConn.Counters.Expired.Add(1)
+				reason = logging.CloseReasonTTL
+			case common.Done(t.ctx):
+				reason = logging.CloseReasonShutdown
+			case errors.Is(err, net.ErrClosed):
+				reason = logging.CloseReasonEvicted
+			}
 			return
 		}
 		if read != 0 {
-			proxyConn.Writer.WritePacket(buffer.Bytes(), client)
+			proxyConn.countDownload(read)
+			proxyConn.Writer.WritePacket(buffer.Bytes(), client.Addr)
 		}
 	}
 }
 
+// logUDPSession writes the access record of the session of client.
+func (t *TrafficHandler) logUDPSession(client inbounds.Peer, proxyConn *UDPConnWrapper, reason string) {
+	t.accessLog.Log(logging.AccessRecord{
+		Network:         meta.ProtocolUDP.String(),
+		Bind:            proxyConn.Counters.Bind,
+		Remote:          proxyConn.Counters.Remote,
+		Client:          client.String(),
+		Upstream:        proxyConn.Conn.RemoteAddr().String(),
+		Start:           proxyConn.Start,
+		Duration:        time.Since(proxyConn.Start),
+		UploadBytes:     proxyConn.uploadBytes.Load(),
+		DownloadBytes:   proxyConn.downloadBytes.Load(),
+		UploadPackets:   proxyConn.uploadPackets.Load(),
+		DownloadPackets: proxyConn.downloadPackets.Load(),
+		Reason:          reason,
+	})
+}
+
+// dropUDPSession closes proxyConn that its session table refused to store
+// along with the first packet of client, size bytes long. A full table
+// counts as a rejection of client.
+func (t *TrafficHandler) dropUDPSession(in *inbounds.Inbound, client inbounds.Peer, proxyConn *UDPConnWrapper, size int, err error) {
+	proxyConn.Close()
+	reason := logging.CloseReasonShutdown // the table is closed with its bind
+	if errors.Is(err, sessions.ErrTableFull) {
+		in.Reject(meta.ProtocolUDP, client.Addr, inbounds.RejectReasonSessionLimit)
+		reason = logging.CloseReasonSessionLimit
+	} else {
+		in.Logger.WarnContext(t.ctx, "drop udp packet",
+			slog.String("source", client.String()),
+			logging.AttrError(err))
+	}
+	t.accessLog.Log(logging.AccessRecord{
+		Network:       meta.ProtocolUDP.String(),
+		Bind:          in.Name,
+		Remote:        proxyConn.Counters.Remote,
+		Client:        client.String(),
+		Upstream:      proxyConn.Conn.RemoteAddr().String(),
+		Start:         proxyConn.Start,
+		UploadBytes:   int64(size),
+		UploadPackets: 1,
+		Reason:        reason,
+	})
+}
+
 func (t *TrafficHandler) ConnHandler(
 	enable bool,
 	in *inbounds.Inbound,
-	out *outbounds.Outbound,
+	targets map[string]relayTarget, // "" is the default
 ) inbounds.ConnHandler {
 	if !enable {
 		return nil
 	}
 
+	relays := make(map[string]*relayCounters, len(targets))
+	for name, target := range targets {
+		relays[name] = t.metrics.relay(meta.ProtocolTCP, in.Name, remoteLabel(target.out))
+	}
 	return inbounds.FuncConnHandler(func(ctx context.Context, local net.Conn) {
-		connLogger := in.Logger.With(logging.AttrIdRandom())
 		defer local.Close()
-		remote, err := out.DialContext(ctx, string(meta.ProtocolTCP))
-		if err != nil {
-			connLogger.ErrorContext(ctx, "dial new tcp connection failed", logging.AttrError(err))
+		name := route.RemoteFromContext(ctx)
+		target, ok := targets[name]
+		if !ok {
+			in.Logger.ErrorContext(ctx, "remote not found", slog.String("remote", name))
 			return
 		}
-		defer remote.Close()
+		ctx = meta.ContextWithMetadata(ctx, meta.Metadata{
+			Source:      M.AddrPortFromNet(local.RemoteAddr()),
+			Destination: M.AddrPortFromNet(local.LocalAddr()),
+			PortOffsets: target.portOffsets,
+		})
+		t.relayConn(ctx, in, target.out, relays[name], local, func(ctx context.Context) (net.Conn, error) {
+			return target.out.DialContext(ctx, string(meta.ProtocolTCP))
+		})
+	})
+}
 
-		if connLogger.Enabled(ctx, slog.LevelDebug) {
-			connLogger.DebugContext(ctx, "new tcp connection established",
-				slog.String("source", local.RemoteAddr().String()),
-				slog.String("remote", remote.RemoteAddr().String()),
-				slog.String("local", remote.LocalAddr().String()),
-			)
-		}
+// relayConn copies between local and the connection returned by dial until
+// both are done, and records the relay in counters and the access log.
+func (t *TrafficHandler) relayConn(
+	ctx context.Context,
+	in *inbounds.Inbound,
+	out *outbounds.Outbound,
+	counters *relayCounters,
+	local net.Conn,
+	dial func(ctx context.Context) (net.Conn, error),
+) {
+	connLogger := in.Logger.With(logging.AttrIdRandom())
+	counters.Accepted.Add(1)
 
-		if err = bufio.CopyConn(ctx, local, remote); err != nil {
-			connLogger.ErrorContext(ctx, "copy connections aborted", logging.AttrError(err))
-		}
-		connLogger.DebugContext(ctx, "connection closed")
-	})
+	var (
+		start            = time.Now()
+		upload, download atomic.Int64
+		upstream         string
+		reason           = logging.CloseReasonError
+		firstEOF         atomic.Pointer[string]
+	)
+	if t.accessLog.Enabled() {
+		defer func() {
+			t.accessLog.Log(logging.AccessRecord{
+				Network:       meta.ProtocolTCP.String(),
+				Bind:          in.Name,
+				Remote:        remoteLabel(out),
+				Client:        local.RemoteAddr().String(),
+				Upstream:      upstream,
+				Start:         start,
+				Duration:      time.Since(start),
+				UploadBytes:   upload.Load(),
+				DownloadBytes: download.Load(),
+				Reason:        reason,
+			})
+		}()
+	}
+
+	remote, err := dial(ctx)
+	if err != nil {
+		t.metrics.dialFailures.With(in.Name, remoteLabel(out), dialer.FailureReason(err)).Add(1)
+		connLogger.ErrorContext(ctx, "dial new tcp connection failed", logging.AttrError(err))
+		return
+	}
+	defer remote.Close()
+	counters.Active.Add(1)
+	defer counters.Active.Add(-1)
+	upstream = remote.RemoteAddr().String()
+
+	if connLogger.Enabled(ctx, slog.LevelDebug) {
+		connLogger.DebugContext(ctx, "new tcp connection established",
+			slog.String("source", local.RemoteAddr().String()),
+			slog.String("remote", remote.RemoteAddr().String()),
+			slog.String("local", remote.LocalAddr().String()),
+		)
+	}
+
+	if t.accessLog.Enabled() {
+		// tracking EOF hides the underlying connections from zero-copy,
+		// so only do it when someone reads the result.
+		local = &eofConn{Conn: local, reason: logging.CloseReasonClientEOF, first: &firstEOF}
+		remote = &eofConn{Conn: remote, reason: logging.CloseReasonUpstreamEOF, first: &firstEOF}
+	}
+	local = bufio.NewInt64CounterConn(local,
+		[]*atomic.Int64{counters.UploadBytes, &upload}, []*atomic.Int64{counters.DownloadBytes, &download})
+	err = bufio.CopyConn(ctx, local, remote)
+	switch {
+	case common.Done(ctx):
+		reason = logging.CloseReasonShutdown
+	case err != nil:
+		connLogger.ErrorContext(ctx, "copy connections aborted", logging.AttrError(err))
+	case firstEOF.Load() != nil:
+		reason = *firstEOF.Load()
+	}
+	connLogger.DebugContext(ctx, "connection closed")
+}
+
+// eofConn records which side of a relay reached EOF first.
+type eofConn struct {
+	net.Conn
+	reason string
+	first  *atomic.Pointer[string]
+}
+
+func (c *eofConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if errors.Is(err, io.EOF) {
+		c.first.CompareAndSwap(nil, &c.reason)
+	}
+	return n, err
+}
+
+func (c *eofConn) CloseWrite() error {
+	return N.CloseWrite(c.Conn)
 }
 
 func newLogger(config LogConfig) (*slog.Logger, error) {